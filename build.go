@@ -1,12 +1,18 @@
 package httpd
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -27,7 +33,17 @@ type DependencyService interface {
 
 //go:generate faux --interface GenerateConfig --output fakes/generate_config.go
 type GenerateConfig interface {
-	Generate(workingDir, platformPath string, buildEnvironment BuildEnvironment) error
+	Generate(workingDir, platformPath, serverRoot string, buildEnvironment BuildEnvironment) error
+}
+
+//go:generate faux --interface CheckConfig --output fakes/check_config.go
+type CheckConfig interface {
+	Check(configPath, appRoot, serverRoot, platformPath string) error
+}
+
+//go:generate faux --interface BuildModule --output fakes/build_module.go
+type BuildModule interface {
+	Build(source ModuleSource, serverRoot, layerPath string) error
 }
 
 //go:generate faux --interface SBOMGenerator --output fakes/sbom_generator.go
@@ -37,19 +53,79 @@ type SBOMGenerator interface {
 
 type BuildEnvironment struct {
 	BasicAuthFile             string
+	BuiltModules              []string
+	CacheMaxSize              string `env:"BP_WEB_SERVER_CACHE_MAX_SIZE"`
+	CachePaths                string `env:"BP_WEB_SERVER_CACHE_PATHS"`
+	FastCGIPattern            string `env:"BP_WEB_SERVER_FASTCGI_PATTERN"`
+	FastCGIUpstream           string `env:"BP_WEB_SERVER_FASTCGI_UPSTREAM"`
 	HTTPDVersion              string `env:"BP_HTTPD_VERSION"`
+	LogRedactHeaders          string `env:"BP_WEB_SERVER_LOG_REDACT_HEADERS"`
+	LogRedactQueryParams      string `env:"BP_WEB_SERVER_LOG_REDACT_QUERY_PARAMS"`
+	MaxRequestWorkers         string `env:"BP_HTTPD_MAX_REQUEST_WORKERS"`
+	Modules                   string `env:"BP_HTTPD_MODULES"`
+	MPM                       string `env:"BP_HTTPD_MPM"`
+	PlanConfDir               string
+	ProxyHealthCheckInterval  string `env:"BP_WEB_SERVER_PROXY_HEALTH_CHECK_INTERVAL"`
+	ProxyHealthCheckPath      string `env:"BP_WEB_SERVER_PROXY_HEALTH_CHECK_PATH"`
+	ProxyLBMethod             string `env:"BP_WEB_SERVER_PROXY_LB_METHOD"`
+	ProxyPath                 string `env:"BP_WEB_SERVER_PROXY_PATH"`
+	ProxyRetry                string `env:"BP_WEB_SERVER_PROXY_RETRY"`
+	ProxyStickySession        string `env:"BP_WEB_SERVER_PROXY_STICKY_SESSION"`
+	ProxyUpstreams            string `env:"BP_WEB_SERVER_PROXY_UPSTREAMS"`
 	Reload                    bool   `env:"BP_LIVE_RELOAD_ENABLED"`
+	ReloadIgnorePatterns      string `env:"BP_LIVE_RELOAD_IGNORE_PATTERNS"`
+	ThreadsPerChild           string `env:"BP_HTTPD_THREADS_PER_CHILD"`
 	WebServer                 string `env:"BP_WEB_SERVER"`
+	WebServerBasePath         string `env:"BP_WEB_SERVER_BASE_PATH"`
+	WebServerConfDir          string `env:"BP_WEB_SERVER_CONF_DIR"`
+	WebServerLocations        string `env:"BP_WEB_SERVER_LOCATIONS"`
+	WebServerFixPermissions   bool   `env:"BP_WEB_SERVER_FIX_PERMISSIONS"`
 	WebServerForceHTTPS       bool   `env:"BP_WEB_SERVER_FORCE_HTTPS"`
 	WebServerPushStateEnabled bool   `env:"BP_WEB_SERVER_ENABLE_PUSH_STATE"`
 	WebServerRoot             string `env:"BP_WEB_SERVER_ROOT"`
 }
 
+// liveReloadWatchPatterns match the files that httpd reads its configuration
+// from when BP_LIVE_RELOAD_ENABLED is set.
+var liveReloadWatchPatterns = []string{"**/*.conf", "**/_redirects", "**/_headers"}
+
+// DefaultMPM is the multi-processing module used when BP_HTTPD_MPM is not set.
+const DefaultMPM = "event"
+
+func (e BuildEnvironment) selectedMPM() string {
+	if e.MPM == "" {
+		return DefaultMPM
+	}
+	return e.MPM
+}
+
+// validateWorkers checks the worker limits that are passed on to the launch
+// environment, as an invalid value would stop the app from starting.
+func (e BuildEnvironment) validateWorkers() error {
+	for _, limit := range [][2]string{
+		{"BP_HTTPD_MAX_REQUEST_WORKERS", e.MaxRequestWorkers},
+		{"BP_HTTPD_THREADS_PER_CHILD", e.ThreadsPerChild},
+	} {
+		name, value := limit[0], limit[1]
+		if value == "" || value == "auto" {
+			continue
+		}
+
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("failed: %s must be 'auto' or a positive integer, got '%s'", name, value)
+		}
+	}
+
+	return nil
+}
+
 func Build(
 	buildEnvironment BuildEnvironment,
 	entries EntryResolver,
 	dependencies DependencyService,
 	generateConfig GenerateConfig,
+	checkConfig CheckConfig,
+	buildModule BuildModule,
 	sbomGenerator SBOMGenerator,
 	clock chronos.Clock,
 	logger scribe.Emitter,
@@ -65,6 +141,55 @@ func Build(
 		entry, sortedEntries := entries.Resolve("httpd", context.Plan.Entries, priorities)
 		logger.Candidates(sortedEntries)
 
+		requirements, err := mergePlanRequirements(context.Plan.Entries)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		// The requirements of other buildpacks are met through the generated
+		// config, which never replaces an httpd.conf of the app unless
+		// BP_WEB_SERVER asks for it.
+		generate := buildEnvironment.WebServer == "httpd"
+		if !requirements.empty() {
+			exists, err := fs.Exists(filepath.Join(context.WorkingDir, "httpd.conf"))
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.Process("Applying the requirements of the build plan")
+			if exists && !generate {
+				logger.Subprocess("WARNING: The app provides its own httpd.conf, the requirements of the build plan are not applied to it")
+			} else {
+				buildEnvironment = requirements.apply(buildEnvironment, logger)
+				generate = true
+			}
+			logger.Break()
+		}
+
+		err = buildEnvironment.validateWorkers()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		// The FastCGI upstream is passed on to the generated config through the
+		// launch environment, so that it can be changed without a rebuild.
+		if buildEnvironment.FastCGIUpstream != "" {
+			buildEnvironment.FastCGIUpstream, err = fastCGIUpstreamURL(buildEnvironment.FastCGIUpstream)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		// The disk cache is only cleaned at launch when the generated config
+		// caches any paths.
+		var cacheMaxSize string
+		if generate {
+			cacheMaxSize, err = buildEnvironment.cacheMaxSize()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		httpdLayer, err := context.Layers.Get("httpd")
 		if err != nil {
 			return packit.BuildResult{}, err
@@ -90,16 +215,24 @@ func Build(
 			logger.Break()
 		}
 
-		launch, _ := entries.MergeLayerTypes("httpd", context.Plan.Entries)
+		launch, build := entries.MergeLayerTypes("httpd", context.Plan.Entries)
 		bom := dependencies.GenerateBillOfMaterials(dependency)
 
+		var buildMetadata packit.BuildMetadata
+		if build {
+			buildMetadata.BOM = bom
+		}
+
 		var launchMetadata packit.LaunchMetadata
 		if launch {
 			launchMetadata.BOM = bom
 		}
 
-		command := "httpd"
+		// httpd is started through a wrapper that turns SIGTERM into a
+		// graceful stop, so that in-flight requests are not dropped.
+		command := filepath.Join(httpdLayer.Path, "bin", "start-httpd")
 		args := []string{
+			"httpd",
 			"-f",
 			filepath.Join(context.WorkingDir, "httpd.conf"),
 			"-k",
@@ -117,17 +250,31 @@ func Build(
 		}
 
 		if buildEnvironment.Reload {
+			// Static files are served from disk on every request, so only
+			// changes to the configuration need httpd to pick them up. Those
+			// are applied through a graceful reload rather than a restart.
+			watchArgs := []string{
+				"--signal", "SIGUSR1",
+				"--watch", context.WorkingDir,
+			}
+			for _, pattern := range liveReloadWatchPatterns {
+				watchArgs = append(watchArgs, "--filter", pattern)
+			}
+			for _, pattern := range strings.Split(buildEnvironment.ReloadIgnorePatterns, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					watchArgs = append(watchArgs, "--ignore", pattern)
+				}
+			}
+
 			launchMetadata.Processes = []packit.Process{
 				{
 					Type:    "web",
 					Command: "watchexec",
-					Args: append([]string{
-						"--restart",
-						"--watch", context.WorkingDir,
+					Args: append(append(watchArgs,
 						"--shell", "none",
 						"--",
 						command,
-					}, args...),
+					), args...),
 					Default: true,
 					Direct:  true,
 				},
@@ -140,79 +287,260 @@ func Build(
 			}
 		}
 
-		if buildEnvironment.WebServer == "httpd" {
-			err = generateConfig.Generate(context.WorkingDir, context.Platform.Path, buildEnvironment)
+		cachedSHA, ok := httpdLayer.Metadata["cache_sha"].(string)
+		if ok && cachedSHA == dependency.SHA256 { //nolint:staticcheck
+			logger.Process("Reusing cached layer %s", httpdLayer.Path)
+			logger.Break()
+
+			httpdLayer.Launch, httpdLayer.Build, httpdLayer.Cache = launch, build, true
+			httpdLayer.ExecD = []string{filepath.Join(context.CNBPath, "bin", "configure-runtime")}
+			err = setRuntimeEnvironment(&httpdLayer, buildEnvironment, cacheMaxSize)
 			if err != nil {
 				return packit.BuildResult{}, err
 			}
-		}
 
-		cachedSHA, ok := httpdLayer.Metadata["cache_sha"].(string)
-		if ok && cachedSHA == dependency.SHA256 { //nolint:staticcheck
-			logger.Process("Reusing cached layer %s", httpdLayer.Path)
+			logger.LaunchProcesses(launchMetadata.Processes)
+		} else {
+			logger.Process("Executing build process")
+
+			httpdLayer, err = httpdLayer.Reset()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			// The layer is cached so that a reused layer still holds the
+			// server, which later steps of the build run against.
+			httpdLayer.Launch, httpdLayer.Build, httpdLayer.Cache = launch, build, true
+
+			logger.Subprocess("Installing Apache HTTP Server %s", dependency.Version)
+			duration, err := clock.Measure(func() error {
+				return dependencies.Deliver(dependency, context.CNBPath, httpdLayer.Path, context.Platform.Path)
+			})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			logger.Action("Completed in %s", duration.Round(time.Millisecond))
 			logger.Break()
 
-			httpdLayer.Launch = launch
+			httpdLayer.Metadata = map[string]interface{}{
+				"cache_sha": dependency.SHA256, //nolint:staticcheck
+			}
+
+			httpdLayer.LaunchEnv.Override("APP_ROOT", context.WorkingDir)
+			httpdLayer.LaunchEnv.Override("SERVER_ROOT", httpdLayer.Path)
+			httpdLayer.LaunchEnv.Default("HTTPD_RUNTIME_DIR", "/tmp")
+
+			// Downstream buildpacks that require httpd at build time find
+			// apxs on the PATH and the headers of the bundled APR libraries.
+			httpdLayer.BuildEnv.Prepend("PATH", filepath.Join(httpdLayer.Path, "bin"), string(os.PathListSeparator))
+			httpdLayer.BuildEnv.Override("SERVER_ROOT", httpdLayer.Path)
+			httpdLayer.BuildEnv.Override("APR_INCLUDE_DIR", filepath.Join(httpdLayer.Path, "include"))
+			httpdLayer.SharedEnv.Override("HTTPD_CONF_D", filepath.Join(httpdLayer.Path, DropInConfDir))
+			httpdLayer.ExecD = []string{filepath.Join(context.CNBPath, "bin", "configure-runtime")}
+			err = setRuntimeEnvironment(&httpdLayer, buildEnvironment, cacheMaxSize)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.EnvironmentVariables(httpdLayer)
 
 			logger.LaunchProcesses(launchMetadata.Processes)
 
-			return packit.BuildResult{
-				Layers: []packit.Layer{httpdLayer},
-				Launch: launchMetadata,
-			}, nil
-		}
+			logger.GeneratingSBOM(httpdLayer.Path)
+			var sbomContent sbom.SBOM
+			duration, err = clock.Measure(func() error {
+				sbomContent, err = sbomGenerator.GenerateFromDependency(dependency, httpdLayer.Path)
+				return err
+			})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.Action("Completed in %s", duration.Round(time.Millisecond))
+			logger.Break()
 
-		logger.Process("Executing build process")
+			logger.FormattingSBOM(context.BuildpackInfo.SBOMFormats...)
+			httpdLayer.SBOM, err = sbomContent.InFormats(context.BuildpackInfo.SBOMFormats...)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
 
-		httpdLayer, err = httpdLayer.Reset()
+		err = os.MkdirAll(filepath.Dir(command), os.ModePerm)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
-		httpdLayer.Launch = launch
 
-		logger.Subprocess("Installing Apache HTTP Server %s", dependency.Version)
-		duration, err := clock.Measure(func() error {
-			return dependencies.Deliver(dependency, context.CNBPath, httpdLayer.Path, context.Platform.Path)
-		})
+		err = fs.Copy(filepath.Join(context.CNBPath, "bin", "start-httpd"), command)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
-		logger.Action("Completed in %s", duration.Round(time.Millisecond))
-		logger.Break()
 
-		httpdLayer.Metadata = map[string]interface{}{
-			"cache_sha": dependency.SHA256, //nolint:staticcheck
+		// The drop-in directory is emptied so that a reused layer does not keep
+		// the fragments that other buildpacks placed in it during an earlier
+		// build.
+		confD := filepath.Join(httpdLayer.Path, DropInConfDir)
+		err = os.RemoveAll(confD)
+		if err != nil {
+			return packit.BuildResult{}, err
 		}
 
-		httpdLayer.LaunchEnv.Override("APP_ROOT", context.WorkingDir)
-		httpdLayer.LaunchEnv.Override("SERVER_ROOT", httpdLayer.Path)
-
-		logger.EnvironmentVariables(httpdLayer)
+		err = os.MkdirAll(confD, os.ModePerm)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
 
-		logger.LaunchProcesses(launchMetadata.Processes)
+		layers := []packit.Layer{httpdLayer}
 
-		logger.GeneratingSBOM(httpdLayer.Path)
-		var sbomContent sbom.SBOM
-		duration, err = clock.Measure(func() error {
-			sbomContent, err = sbomGenerator.GenerateFromDependency(dependency, httpdLayer.Path)
-			return err
-		})
+		sources, err := FindModuleSources(context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
-		logger.Action("Completed in %s", duration.Round(time.Millisecond))
-		logger.Break()
+		if len(sources) > 0 {
+			logger.Process("Building out-of-tree modules")
+		}
+
+		for _, source := range sources {
+			moduleLayer, err := context.Layers.Get(fmt.Sprintf("module-%s", source.Name))
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			// A module is rebuilt when its sources or the server that it is
+			// built against change.
+			cachedSHA, _ := moduleLayer.Metadata["cache_sha"].(string)
+			serverSHA, _ := moduleLayer.Metadata["server_sha"].(string)
+			if cachedSHA == source.SHA256 && serverSHA == dependency.SHA256 { //nolint:staticcheck
+				logger.Subprocess("Reusing cached module mod_%s", source.Name)
+			} else {
+				moduleLayer, err = moduleLayer.Reset()
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				logger.Subprocess("Building module mod_%s %s", source.Name, source.Version)
+				duration, err := clock.Measure(func() error {
+					return buildModule.Build(source, httpdLayer.Path, moduleLayer.Path)
+				})
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				logger.Action("Completed in %s", duration.Round(time.Millisecond))
+
+				moduleLayer.Metadata = map[string]interface{}{
+					"cache_sha":  source.SHA256,
+					"server_sha": dependency.SHA256, //nolint:staticcheck
+				}
+
+				sbomContent, err := sbomGenerator.GenerateFromDependency(postal.Dependency{
+					ID:       fmt.Sprintf("mod_%s", source.Name),
+					Name:     fmt.Sprintf("mod_%s", source.Name),
+					Version:  source.Version,
+					Checksum: fmt.Sprintf("sha256:%s", source.SHA256),
+					Source:   source.Path,
+				}, moduleLayer.Path)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				moduleLayer.SBOM, err = sbomContent.InFormats(context.BuildpackInfo.SBOMFormats...)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+			}
+
+			// The layer is cached so that a reused module is restored with the
+			// library that the config loads.
+			moduleLayer.Launch, moduleLayer.Build, moduleLayer.Cache = launch, build, true
+			layers = append(layers, moduleLayer)
+
+			buildEnvironment.BuiltModules = append(buildEnvironment.BuiltModules, filepath.Join(moduleLayer.Path, "modules", fmt.Sprintf("mod_%s.so", source.Name)))
+		}
+
+		if len(sources) > 0 {
+			logger.Break()
+		}
+
+		// The config is generated once the layer is in place so that it can be
+		// checked against the modules of the installed server.
+		if generate {
+			err = generateConfig.Generate(context.WorkingDir, context.Platform.Path, httpdLayer.Path, buildEnvironment)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
 
-		logger.FormattingSBOM(context.BuildpackInfo.SBOMFormats...)
-		httpdLayer.SBOM, err = sbomContent.InFormats(context.BuildpackInfo.SBOMFormats...)
+		// The check also covers a reused layer, as the config of the app may
+		// have changed since the layer was built. An app without an httpd.conf
+		// leaves the config to a later buildpack, which is not checked.
+		configExists, err := fs.Exists(filepath.Join(context.WorkingDir, "httpd.conf"))
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
+		if launch && (generate || configExists) {
+			err = checkConfig.Check(filepath.Join(context.WorkingDir, "httpd.conf"), context.WorkingDir, httpdLayer.Path, context.Platform.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		return packit.BuildResult{
-			Layers: []packit.Layer{httpdLayer},
+			Layers: layers,
+			Build:  buildMetadata,
 			Launch: launchMetadata,
 		}, nil
 	}
 }
+
+// setRuntimeEnvironment passes the MPM and the worker limits configured at
+// build time on to the exec.d helper that sizes the MPM at launch. They are
+// always written so that a reused layer never keeps a value from an earlier
+// build. The FastCGI upstream and the size of the disk cache are only passed
+// on when they are set.
+func setRuntimeEnvironment(layer *packit.Layer, buildEnvironment BuildEnvironment, cacheMaxSize string) error {
+	layer.LaunchEnv.Override("HTTPD_MPM", buildEnvironment.selectedMPM())
+
+	for name, value := range map[string]string{
+		"HTTPD_FASTCGI_UPSTREAM": buildEnvironment.FastCGIUpstream,
+		"HTTPD_CACHE_MAX_SIZE":   cacheMaxSize,
+	} {
+		err := setOptionalLaunchEnv(layer, name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, value := range map[string]string{
+		"BPL_HTTPD_MAX_REQUEST_WORKERS": buildEnvironment.MaxRequestWorkers,
+		"BPL_HTTPD_THREADS_PER_CHILD":   buildEnvironment.ThreadsPerChild,
+	} {
+		if value == "" {
+			value = "auto"
+		}
+		layer.LaunchEnv.Default(name, value)
+	}
+
+	return nil
+}
+
+// setOptionalLaunchEnv sets the default of a launch environment variable, or
+// removes it when the value is empty. The env files of a reused layer are not
+// cleaned up when they are written, so the file of an earlier build is
+// removed as well.
+func setOptionalLaunchEnv(layer *packit.Layer, name, value string) error {
+	key := fmt.Sprintf("%s.default", name)
+	if value != "" {
+		layer.LaunchEnv[key] = value
+		return nil
+	}
+
+	delete(layer.LaunchEnv, key)
+
+	err := os.Remove(filepath.Join(layer.Path, "env.launch", key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
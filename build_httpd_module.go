@@ -0,0 +1,115 @@
+package httpd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/vacation"
+)
+
+type BuildHTTPDModule struct {
+	apxs   Executable
+	logger scribe.Emitter
+}
+
+func NewBuildHTTPDModule(apxs Executable, logger scribe.Emitter) BuildHTTPDModule {
+	return BuildHTTPDModule{
+		apxs:   apxs,
+		logger: logger,
+	}
+}
+
+// Build compiles the C files at the top of the given module sources with the
+// apxs of the server installed at serverRoot, against the headers of the
+// server and of the APR libraries that it bundles, and installs the module as
+// modules/mod_<name>.so in layerPath. The sources are compiled in a scratch
+// directory so that the build leaves the app untouched. Archives are expected
+// to hold the sources in a single top-level directory.
+func (b BuildHTTPDModule) Build(source ModuleSource, serverRoot, layerPath string) error {
+	buildDir, err := os.MkdirTemp("", "module-build")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(buildDir)
+
+	if source.Archive {
+		archive, err := os.Open(source.Path)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		err = vacation.NewArchive(archive).StripComponents(1).Decompress(buildDir)
+		if err != nil {
+			return fmt.Errorf("failed to extract the sources of module '%s': %w", source.Name, err)
+		}
+	} else {
+		err = fs.Copy(source.Path, buildDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(buildDir, "*.c"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return fmt.Errorf("failed: the sources of module '%s' do not contain any *.c files", source.Name)
+	}
+
+	module := fmt.Sprintf("mod_%s.so", source.Name)
+
+	// apxs reads the install locations that the server was configured with,
+	// which do not match where the layer is installed.
+	args := []string{
+		"-S", fmt.Sprintf("PREFIX=%s", serverRoot),
+		"-S", fmt.Sprintf("SBINDIR=%s", filepath.Join(serverRoot, "bin")),
+		"-S", fmt.Sprintf("INCLUDEDIR=%s", filepath.Join(serverRoot, "include")),
+		"-S", fmt.Sprintf("LIBEXECDIR=%s", filepath.Join(serverRoot, "modules")),
+		"-c", "-o", module,
+	}
+	for _, file := range files {
+		args = append(args, filepath.Base(file))
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err = b.apxs.Execute(pexec.Execution{
+		Args: args,
+		Dir:  buildDir,
+		Env: append(os.Environ(),
+			fmt.Sprintf("PATH=%s%c%s", filepath.Join(serverRoot, "bin"), os.PathListSeparator, os.Getenv("PATH")),
+			fmt.Sprintf("LD_LIBRARY_PATH=%s%c%s", filepath.Join(serverRoot, "lib"), os.PathListSeparator, os.Getenv("LD_LIBRARY_PATH")),
+		),
+		Stdout: buffer,
+		Stderr: buffer,
+	})
+	if err != nil {
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			b.logger.Action("%s", line)
+		}
+		return fmt.Errorf("failed: apxs could not build module '%s': %w", source.Name, err)
+	}
+
+	err = os.MkdirAll(filepath.Join(layerPath, "modules"), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// libtool leaves the shared object in .libs.
+	err = fs.Copy(filepath.Join(buildDir, ".libs", module), filepath.Join(layerPath, "modules", module))
+	if err != nil {
+		return fmt.Errorf("failed to install module '%s': %w", source.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package httpd_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd"
+	"github.com/paketo-buildpacks/httpd/fakes"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBuildHTTPDModule(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		sourceDir  string
+		serverRoot string
+		layerPath  string
+
+		executable *fakes.Executable
+		buffer     *bytes.Buffer
+
+		buildHTTPDModule httpd.BuildHTTPDModule
+
+		buildDir string
+	)
+
+	it.Before(func() {
+		var err error
+		sourceDir, err = os.MkdirTemp("", "mod_hello")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(sourceDir, "mod_hello.c"), []byte("/* hello */"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(sourceDir, "util.c"), []byte("/* util */"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(sourceDir, "util.h"), []byte("/* util */"), 0644)).To(Succeed())
+
+		serverRoot, err = os.MkdirTemp("", "server-root")
+		Expect(err).NotTo(HaveOccurred())
+
+		layerPath, err = os.MkdirTemp("", "module-hello")
+		Expect(err).NotTo(HaveOccurred())
+
+		// The fake apxs leaves the module where libtool puts it.
+		executable = &fakes.Executable{}
+		executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+			buildDir = execution.Dir
+			Expect(os.MkdirAll(filepath.Join(execution.Dir, ".libs"), os.ModePerm)).To(Succeed())
+			return os.WriteFile(filepath.Join(execution.Dir, ".libs", "mod_hello.so"), []byte("some-module"), 0644)
+		}
+
+		buffer = bytes.NewBuffer(nil)
+
+		buildHTTPDModule = httpd.NewBuildHTTPDModule(executable, scribe.NewEmitter(buffer))
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(sourceDir)).To(Succeed())
+		Expect(os.RemoveAll(serverRoot)).To(Succeed())
+		Expect(os.RemoveAll(layerPath)).To(Succeed())
+	})
+
+	it("compiles the sources with apxs and installs the module into the layer", func() {
+		err := buildHTTPDModule.Build(httpd.ModuleSource{Name: "hello", Path: sourceDir}, serverRoot, layerPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		execution := executable.ExecuteCall.Receives.Execution
+		Expect(execution.Args).To(Equal([]string{
+			"-S", fmt.Sprintf("PREFIX=%s", serverRoot),
+			"-S", fmt.Sprintf("SBINDIR=%s", filepath.Join(serverRoot, "bin")),
+			"-S", fmt.Sprintf("INCLUDEDIR=%s", filepath.Join(serverRoot, "include")),
+			"-S", fmt.Sprintf("LIBEXECDIR=%s", filepath.Join(serverRoot, "modules")),
+			"-c", "-o", "mod_hello.so",
+			"mod_hello.c", "util.c",
+		}))
+		Expect(execution.Env).To(ContainElement(MatchRegexp(fmt.Sprintf(`^PATH=%s:`, filepath.Join(serverRoot, "bin")))))
+		Expect(execution.Dir).NotTo(Equal(sourceDir))
+
+		Expect(filepath.Join(layerPath, "modules", "mod_hello.so")).To(BeARegularFile())
+		Expect(filepath.Join(sourceDir, ".libs")).NotTo(BeADirectory())
+		Expect(buildDir).NotTo(BeADirectory())
+	})
+
+	context("when the sources are a vendored archive", func() {
+		var archivePath string
+
+		it.Before(func() {
+			archivePath = filepath.Join(sourceDir, "mod_hello-1.0.0.tar.gz")
+
+			archive := bytes.NewBuffer(nil)
+			gzipWriter := gzip.NewWriter(archive)
+			tarWriter := tar.NewWriter(gzipWriter)
+			for name, content := range map[string]string{"mod_hello-1.0.0/": "", "mod_hello-1.0.0/mod_hello.c": "/* hello */"} {
+				header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+				if content == "" {
+					header.Mode, header.Typeflag = 0755, tar.TypeDir
+				}
+				Expect(tarWriter.WriteHeader(header)).To(Succeed())
+				_, err := tarWriter.Write([]byte(content))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(tarWriter.Close()).To(Succeed())
+			Expect(gzipWriter.Close()).To(Succeed())
+
+			Expect(os.WriteFile(archivePath, archive.Bytes(), 0644)).To(Succeed())
+		})
+
+		it("compiles the sources in the top-level directory of the archive", func() {
+			err := buildHTTPDModule.Build(httpd.ModuleSource{Name: "hello", Path: archivePath, Archive: true}, serverRoot, layerPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			args := executable.ExecuteCall.Receives.Execution.Args
+			Expect(args[len(args)-4:]).To(Equal([]string{"-c", "-o", "mod_hello.so", "mod_hello.c"}))
+			Expect(filepath.Join(layerPath, "modules", "mod_hello.so")).To(BeARegularFile())
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the sources do not contain any C files", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(sourceDir, "mod_hello.c"))).To(Succeed())
+				Expect(os.Remove(filepath.Join(sourceDir, "util.c"))).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := buildHTTPDModule.Build(httpd.ModuleSource{Name: "hello", Path: sourceDir}, serverRoot, layerPath)
+				Expect(err).To(MatchError("failed: the sources of module 'hello' do not contain any *.c files"))
+			})
+		})
+
+		context("when apxs fails", func() {
+			it.Before(func() {
+				executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					fmt.Fprintln(execution.Stderr, "mod_hello.c:1: error: expected declaration")
+					return errors.New("exit status 1")
+				}
+			})
+
+			it("prints the output of apxs and returns an error", func() {
+				err := buildHTTPDModule.Build(httpd.ModuleSource{Name: "hello", Path: sourceDir}, serverRoot, layerPath)
+				Expect(err).To(MatchError("failed: apxs could not build module 'hello': exit status 1"))
+				Expect(buffer.String()).To(ContainSubstring("mod_hello.c:1: error: expected declaration"))
+			})
+		})
+
+		context("when the archive cannot be extracted", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(sourceDir, "broken.tar.gz"), []byte("\x1f\x8b broken"), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := buildHTTPDModule.Build(httpd.ModuleSource{Name: "hello", Path: filepath.Join(sourceDir, "broken.tar.gz"), Archive: true}, serverRoot, layerPath)
+				Expect(err).To(MatchError(ContainSubstring("failed to extract the sources of module 'hello'")))
+			})
+		})
+	})
+}
@@ -3,6 +3,7 @@ package httpd_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"github.com/paketo-buildpacks/httpd/fakes"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
 
 	//nolint Ignore SA1019, informed usage of deprecated package
@@ -34,6 +36,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		entryResolver     *fakes.EntryResolver
 		dependencyService *fakes.DependencyService
 		generateConfig    *fakes.GenerateConfig
+		checkConfig       *fakes.CheckConfig
+		buildModule       *fakes.BuildModule
 		sbomGenerator     *fakes.SBOMGenerator
 
 		buffer *bytes.Buffer
@@ -52,6 +56,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		cnbPath, err = os.MkdirTemp("", "cnb-path")
 		Expect(err).NotTo(HaveOccurred())
 
+		Expect(os.MkdirAll(filepath.Join(cnbPath, "bin"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cnbPath, "bin", "start-httpd"), []byte("start-httpd"), 0755)).To(Succeed())
+
 		entryResolver = &fakes.EntryResolver{}
 		entryResolver.ResolveCall.Returns.BuildpackPlanEntry = packit.BuildpackPlanEntry{
 			Name: "http",
@@ -88,13 +95,15 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		}
 
 		generateConfig = &fakes.GenerateConfig{}
+		checkConfig = &fakes.CheckConfig{}
+		buildModule = &fakes.BuildModule{}
 
 		sbomGenerator = &fakes.SBOMGenerator{}
 		sbomGenerator.GenerateFromDependencyCall.Returns.SBOM = sbom.SBOM{}
 
 		buffer = bytes.NewBuffer(nil)
 
-		build = httpd.Build(httpd.BuildEnvironment{}, entryResolver, dependencyService, generateConfig, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))
+		build = httpd.Build(httpd.BuildEnvironment{}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))
 	})
 
 	it.After(func() {
@@ -104,6 +113,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 	})
 
 	it("builds httpd", func() {
+		Expect(os.WriteFile(filepath.Join(workingDir, "httpd.conf"), nil, 0644)).To(Succeed())
+
 		result, err := build(packit.BuildContext{
 			BuildpackInfo: packit.BuildpackInfo{
 				Name:        "Some Buildpack",
@@ -136,12 +147,28 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(layer.Name).To(Equal("httpd"))
 		Expect(layer.Path).To(Equal(filepath.Join(layersDir, "httpd")))
 		Expect(layer.Build).To(BeFalse())
-		Expect(layer.Cache).To(BeFalse())
+		Expect(layer.Cache).To(BeTrue())
 		Expect(layer.Launch).To(BeTrue())
 		Expect(layer.LaunchEnv).To(Equal(packit.Environment{
-			"APP_ROOT.override":    workingDir,
-			"SERVER_ROOT.override": filepath.Join(layersDir, "httpd"),
+			"APP_ROOT.override":                     workingDir,
+			"SERVER_ROOT.override":                  filepath.Join(layersDir, "httpd"),
+			"HTTPD_RUNTIME_DIR.default":             "/tmp",
+			"HTTPD_MPM.override":                    "event",
+			"BPL_HTTPD_MAX_REQUEST_WORKERS.default": "auto",
+			"BPL_HTTPD_THREADS_PER_CHILD.default":   "auto",
+		}))
+		Expect(layer.BuildEnv).To(Equal(packit.Environment{
+			"PATH.prepend":             filepath.Join(layersDir, "httpd", "bin"),
+			"PATH.delim":               ":",
+			"SERVER_ROOT.override":     filepath.Join(layersDir, "httpd"),
+			"APR_INCLUDE_DIR.override": filepath.Join(layersDir, "httpd", "include"),
+		}))
+		Expect(layer.SharedEnv).To(Equal(packit.Environment{
+			"HTTPD_CONF_D.override": filepath.Join(layersDir, "httpd", "conf.d"),
 		}))
+		Expect(filepath.Join(layersDir, "httpd", "conf.d")).To(BeADirectory())
+		Expect(layer.ExecD).To(Equal([]string{filepath.Join(cnbPath, "bin", "configure-runtime")}))
+		Expect(filepath.Join(layersDir, "httpd", "bin", "start-httpd")).To(BeARegularFile())
 		Expect(layer.Metadata).To(Equal(map[string]interface{}{
 			"cache_sha": "some-sha",
 		}))
@@ -163,8 +190,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(result.Launch.Processes).To(Equal([]packit.Process{
 			{
 				Type:    "web",
-				Command: "httpd",
+				Command: filepath.Join(layersDir, "httpd", "bin", "start-httpd"),
 				Args: []string{
+					"httpd",
 					"-f",
 					filepath.Join(workingDir, "httpd.conf"),
 					"-k",
@@ -176,6 +204,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			},
 		}))
 
+		Expect(result.Build.BOM).To(BeEmpty())
+
 		Expect(layer.SBOM.Formats()).To(HaveLen(2))
 		cdx := layer.SBOM.Formats()[0]
 		spdx := layer.SBOM.Formats()[1]
@@ -256,6 +286,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 		Expect(generateConfig.GenerateCall.CallCount).To(Equal(0))
 
+		Expect(checkConfig.CheckCall.Receives.ConfigPath).To(Equal(filepath.Join(workingDir, "httpd.conf")))
+		Expect(checkConfig.CheckCall.Receives.AppRoot).To(Equal(workingDir))
+		Expect(checkConfig.CheckCall.Receives.ServerRoot).To(Equal(filepath.Join(layersDir, "httpd")))
+		Expect(checkConfig.CheckCall.Receives.PlatformPath).To(Equal("platform"))
+
 		Expect(sbomGenerator.GenerateFromDependencyCall.Receives.Dependency).To(Equal(postal.Dependency{
 			ID:           "httpd",
 			SHA256:       "some-sha", //nolint:staticcheck
@@ -322,11 +357,15 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(layer.Name).To(Equal("httpd"))
 			Expect(layer.Path).To(Equal(filepath.Join(layersDir, "httpd")))
 			Expect(layer.Build).To(BeFalse())
-			Expect(layer.Cache).To(BeFalse())
+			Expect(layer.Cache).To(BeTrue())
 			Expect(layer.Launch).To(BeTrue())
 			Expect(layer.LaunchEnv).To(Equal(packit.Environment{
-				"APP_ROOT.override":    workingDir,
-				"SERVER_ROOT.override": filepath.Join(layersDir, "httpd"),
+				"APP_ROOT.override":                     workingDir,
+				"SERVER_ROOT.override":                  filepath.Join(layersDir, "httpd"),
+				"HTTPD_RUNTIME_DIR.default":             "/tmp",
+				"HTTPD_MPM.override":                    "event",
+				"BPL_HTTPD_MAX_REQUEST_WORKERS.default": "auto",
+				"BPL_HTTPD_THREADS_PER_CHILD.default":   "auto",
 			}))
 			Expect(layer.Metadata).To(Equal(map[string]interface{}{
 				"cache_sha": "some-sha",
@@ -349,8 +388,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(result.Launch.Processes).To(Equal([]packit.Process{
 				{
 					Type:    "web",
-					Command: "httpd",
+					Command: filepath.Join(layersDir, "httpd", "bin", "start-httpd"),
 					Args: []string{
+						"httpd",
 						"-f",
 						filepath.Join(workingDir, "httpd.conf"),
 						"-k",
@@ -382,6 +422,64 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when httpd is required at build time", func() {
+		it.Before(func() {
+			entryResolver.MergeLayerTypesCall.Returns.Launch = false
+			entryResolver.MergeLayerTypesCall.Returns.Build = true
+		})
+
+		it("makes the layer available to later buildpacks", func() {
+			result, err := build(packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name: "httpd",
+							Metadata: map[string]interface{}{
+								"build": true,
+							},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(entryResolver.MergeLayerTypesCall.Receives.Name).To(Equal("httpd"))
+
+			Expect(result.Layers).To(HaveLen(1))
+			layer := result.Layers[0]
+
+			Expect(layer.Build).To(BeTrue())
+			Expect(layer.Cache).To(BeTrue())
+			Expect(layer.Launch).To(BeFalse())
+			Expect(layer.BuildEnv).To(HaveKeyWithValue("SERVER_ROOT.override", filepath.Join(layersDir, "httpd")))
+
+			Expect(result.Build.BOM).To(Equal([]packit.BOMEntry{
+				{
+					Name: "httpd",
+					Metadata: paketosbom.BOMMetadata{
+						Version: "httpd-dependency-version",
+						Checksum: paketosbom.BOMChecksum{
+							Algorithm: paketosbom.SHA256,
+							Hash:      "httpd-dependency-sha",
+						},
+						URI: "httpd-dependency-uri",
+					},
+				},
+			}))
+			Expect(result.Launch.BOM).To(BeEmpty())
+
+			Expect(checkConfig.CheckCall.CallCount).To(Equal(0))
+		})
+	})
+
 	context("when the version source is buildpack.yml", func() {
 		it.Before(func() {
 			entryResolver.ResolveCall.Returns.BuildpackPlanEntry = packit.BuildpackPlanEntry{
@@ -438,6 +536,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				entryResolver,
 				dependencyService,
 				generateConfig,
+				checkConfig,
+				buildModule,
 				sbomGenerator,
 				chronos.DefaultClock,
 				scribe.NewEmitter(buffer),
@@ -470,12 +570,419 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 			Expect(generateConfig.GenerateCall.Receives.WorkingDir).To(Equal(workingDir))
 			Expect(generateConfig.GenerateCall.Receives.PlatformPath).To(Equal("platform"))
+			Expect(generateConfig.GenerateCall.Receives.ServerRoot).To(Equal(filepath.Join(layersDir, "httpd")))
 			Expect(generateConfig.GenerateCall.Receives.BuildEnvironment).To(Equal(httpd.BuildEnvironment{
 				WebServer: "httpd",
 			}))
 		})
 	})
 
+	context("when the build plan requires config features", func() {
+		var (
+			buildContext packit.BuildContext
+			buildWith    func(buildEnvironment httpd.BuildEnvironment) (packit.BuildResult, error)
+		)
+
+		it.Before(func() {
+			buildContext = packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Platform:   packit.Platform{Path: "platform"},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name: "httpd",
+							Metadata: map[string]interface{}{
+								"launch":        true,
+								"modules":       []interface{}{"proxy", "proxy_fcgi"},
+								"document-root": "htdocs",
+							},
+						},
+						{
+							Name: "httpd",
+							Metadata: map[string]interface{}{
+								"launch":        true,
+								"modules":       "headers",
+								"conf-dir":      "conf.d",
+								"document-root": "./htdocs/",
+							},
+						},
+					},
+				},
+			}
+
+			buildWith = func(buildEnvironment httpd.BuildEnvironment) (packit.BuildResult, error) {
+				return httpd.Build(buildEnvironment, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+			}
+		})
+
+		it("generates a httpd.conf that meets the requirements of all entries", func() {
+			_, err := buildWith(httpd.BuildEnvironment{Modules: "expires"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateConfig.GenerateCall.CallCount).To(Equal(1))
+			Expect(generateConfig.GenerateCall.Receives.BuildEnvironment).To(Equal(httpd.BuildEnvironment{
+				Modules:       "expires,proxy,proxy_fcgi,headers",
+				PlanConfDir:   "conf.d",
+				WebServerRoot: "htdocs",
+			}))
+
+			Expect(buffer.String()).To(ContainSubstring("Applying the requirements of the build plan"))
+			Expect(buffer.String()).To(ContainSubstring("Requires the modules 'proxy', 'proxy_fcgi', 'headers'"))
+			Expect(buffer.String()).To(ContainSubstring("Requires the config fragments in 'conf.d'"))
+			Expect(buffer.String()).To(ContainSubstring("Requires the document root 'htdocs'"))
+		})
+
+		context("when the user configures the directories", func() {
+			it("keeps the configured directories", func() {
+				_, err := buildWith(httpd.BuildEnvironment{
+					WebServerConfDir: "httpd.d",
+					WebServerRoot:    "public",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(generateConfig.GenerateCall.Receives.BuildEnvironment.WebServerConfDir).To(Equal("httpd.d"))
+				Expect(generateConfig.GenerateCall.Receives.BuildEnvironment.WebServerRoot).To(Equal("public"))
+
+				Expect(buffer.String()).To(ContainSubstring("BP_WEB_SERVER_CONF_DIR takes precedence over the config fragments in 'conf.d'"))
+				Expect(buffer.String()).To(ContainSubstring("BP_WEB_SERVER_ROOT takes precedence over the document root 'htdocs'"))
+			})
+		})
+
+		context("when the app provides its own httpd.conf", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "httpd.conf"), nil, 0644)).To(Succeed())
+			})
+
+			it("does not replace it", func() {
+				_, err := buildWith(httpd.BuildEnvironment{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(generateConfig.GenerateCall.CallCount).To(Equal(0))
+				Expect(buffer.String()).To(ContainSubstring("WARNING: The app provides its own httpd.conf, the requirements of the build plan are not applied to it"))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the entries require different document roots", func() {
+				it.Before(func() {
+					buildContext.Plan.Entries[1].Metadata["document-root"] = "web"
+				})
+
+				it("returns an error", func() {
+					_, err := buildWith(httpd.BuildEnvironment{})
+					Expect(err).To(MatchError("failed: the build plan entries for httpd require different values for 'document-root': 'htdocs', 'web'"))
+
+					Expect(dependencyService.DeliverCall.CallCount).To(Equal(0))
+				})
+			})
+
+			context("when the modules are not a list of strings", func() {
+				it.Before(func() {
+					buildContext.Plan.Entries[0].Metadata["modules"] = []interface{}{"proxy", 1}
+				})
+
+				it("returns an error", func() {
+					_, err := buildWith(httpd.BuildEnvironment{})
+					Expect(err).To(MatchError("failed: the build plan metadata 'modules' of httpd must be a list of strings, got '[proxy 1]'"))
+				})
+			})
+
+			context("when a directory is not a string", func() {
+				it.Before(func() {
+					buildContext.Plan.Entries[1].Metadata["conf-dir"] = true
+				})
+
+				it("returns an error", func() {
+					_, err := buildWith(httpd.BuildEnvironment{})
+					Expect(err).To(MatchError("failed: the build plan metadata 'conf-dir' of httpd must be a string, got 'true'"))
+				})
+			})
+		})
+	})
+
+	context("when a FastCGI upstream is set", func() {
+		var buildContext packit.BuildContext
+
+		it.Before(func() {
+			buildContext = packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{Name: "httpd"},
+					},
+				},
+			}
+		})
+
+		it("passes the upstream on to the generated config through the launch environment", func() {
+			result, err := httpd.Build(httpd.BuildEnvironment{
+				WebServer:       "httpd",
+				FastCGIUpstream: "127.0.0.1:9000",
+			}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("HTTPD_FASTCGI_UPSTREAM.default", "fcgi://127.0.0.1:9000"))
+			Expect(generateConfig.GenerateCall.Receives.BuildEnvironment.FastCGIUpstream).To(Equal("fcgi://127.0.0.1:9000"))
+		})
+
+		context("when the upstream is required by the build plan", func() {
+			it.Before(func() {
+				buildContext.Plan.Entries[0].Metadata = map[string]interface{}{
+					"fastcgi-upstream": "unix:/tmp/php-fpm.sock",
+				}
+			})
+
+			it("uses the upstream of the build plan", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("HTTPD_FASTCGI_UPSTREAM.default", "unix:/tmp/php-fpm.sock|fcgi://localhost"))
+				Expect(generateConfig.GenerateCall.CallCount).To(Equal(1))
+				Expect(buffer.String()).To(ContainSubstring("Requires the FastCGI upstream 'unix:/tmp/php-fpm.sock'"))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the upstream is not an address", func() {
+				it("returns an error", func() {
+					_, err := httpd.Build(httpd.BuildEnvironment{
+						WebServer:       "httpd",
+						FastCGIUpstream: "php-fpm",
+					}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+					Expect(err).To(MatchError("failed: the FastCGI upstream must be a '<host>:<port>' address or the absolute path of a unix socket, got 'php-fpm'"))
+				})
+			})
+		})
+	})
+
+	context("when BP_WEB_SERVER_CACHE_PATHS is set", func() {
+		var buildContext packit.BuildContext
+
+		it.Before(func() {
+			buildContext = packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{Name: "httpd"},
+					},
+				},
+			}
+		})
+
+		it("passes the size of the cache on to the launch environment", func() {
+			result, err := httpd.Build(httpd.BuildEnvironment{
+				WebServer:  "httpd",
+				CachePaths: "/api",
+			}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("HTTPD_CACHE_MAX_SIZE.default", "100M"))
+		})
+
+		context("when it does not name any path", func() {
+			it("does not pass the size of the cache on", func() {
+				result, err := httpd.Build(httpd.BuildEnvironment{
+					WebServer:  "httpd",
+					CachePaths: " , ",
+				}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers[0].LaunchEnv).NotTo(HaveKey("HTTPD_CACHE_MAX_SIZE.default"))
+			})
+		})
+
+		context("when the config is not generated", func() {
+			it("does not pass the size of the cache on", func() {
+				result, err := httpd.Build(httpd.BuildEnvironment{
+					CachePaths: "/api",
+				}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers[0].LaunchEnv).NotTo(HaveKey("HTTPD_CACHE_MAX_SIZE.default"))
+				Expect(generateConfig.GenerateCall.CallCount).To(Equal(0))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the size of the cache is not a number of bytes", func() {
+				it("returns an error", func() {
+					_, err := httpd.Build(httpd.BuildEnvironment{
+						WebServer:    "httpd",
+						CachePaths:   "/api",
+						CacheMaxSize: "lots",
+					}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+					Expect(err).To(MatchError("failed: BP_WEB_SERVER_CACHE_MAX_SIZE must be a number of bytes with an optional 'K', 'M' or 'G' suffix, got 'lots'"))
+				})
+			})
+		})
+	})
+
+	context("when the app contains module sources", func() {
+		var sourceSHA string
+
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "modules-src", "mod_hello"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "mod_hello", "mod_hello.c"), []byte("/* hello */"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "mod_hello", "VERSION"), []byte("1.0.0\n"), 0644)).To(Succeed())
+
+			var err error
+			sourceSHA, err = fs.NewChecksumCalculator().Sum(filepath.Join(workingDir, "modules-src", "mod_hello"))
+			Expect(err).NotTo(HaveOccurred())
+
+			build = httpd.Build(
+				httpd.BuildEnvironment{
+					WebServer: "httpd",
+				},
+				entryResolver,
+				dependencyService,
+				generateConfig,
+				checkConfig,
+				buildModule,
+				sbomGenerator,
+				chronos.DefaultClock,
+				scribe.NewEmitter(buffer),
+			)
+		})
+
+		it("builds each module into its own launch layer and loads it", func() {
+			result, err := build(packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:        "Some Buildpack",
+					Version:     "1.2.3",
+					SBOMFormats: []string{sbom.CycloneDXFormat, sbom.SPDXFormat},
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Platform:   packit.Platform{Path: "platform"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buildModule.BuildCall.Receives.Source).To(Equal(httpd.ModuleSource{
+				Name:    "hello",
+				Version: "1.0.0",
+				Path:    filepath.Join(workingDir, "modules-src", "mod_hello"),
+				SHA256:  sourceSHA,
+			}))
+			Expect(buildModule.BuildCall.Receives.ServerRoot).To(Equal(filepath.Join(layersDir, "httpd")))
+			Expect(buildModule.BuildCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "module-hello")))
+
+			Expect(result.Layers).To(HaveLen(2))
+			layer := result.Layers[1]
+			Expect(layer.Name).To(Equal("module-hello"))
+			Expect(layer.Launch).To(BeTrue())
+			Expect(layer.Build).To(BeFalse())
+			Expect(layer.Cache).To(BeTrue())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{
+				"cache_sha":  sourceSHA,
+				"server_sha": "some-sha",
+			}))
+			Expect(layer.SBOM.Formats()).To(HaveLen(2))
+
+			Expect(sbomGenerator.GenerateFromDependencyCall.Receives.Dependency).To(Equal(postal.Dependency{
+				ID:       "mod_hello",
+				Name:     "mod_hello",
+				Version:  "1.0.0",
+				Checksum: "sha256:" + sourceSHA,
+				Source:   filepath.Join(workingDir, "modules-src", "mod_hello"),
+			}))
+			Expect(sbomGenerator.GenerateFromDependencyCall.Receives.Dir).To(Equal(filepath.Join(layersDir, "module-hello")))
+
+			Expect(generateConfig.GenerateCall.Receives.BuildEnvironment.BuiltModules).To(Equal([]string{
+				filepath.Join(layersDir, "module-hello", "modules", "mod_hello.so"),
+			}))
+
+			Expect(buffer.String()).To(ContainSubstring("Building out-of-tree modules"))
+			Expect(buffer.String()).To(ContainSubstring("Building module mod_hello 1.0.0"))
+		})
+
+		context("when the module layer metadata contains a cache match", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, "module-hello.toml"),
+					[]byte(fmt.Sprintf("[metadata]\ncache_sha = %q\nserver_sha = \"some-sha\"\n", sourceSHA)), 0600)).To(Succeed())
+			})
+
+			it("reuses the module", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+					CNBPath:    cnbPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildModule.BuildCall.CallCount).To(Equal(0))
+				Expect(result.Layers).To(HaveLen(2))
+				Expect(result.Layers[1].Launch).To(BeTrue())
+				Expect(result.Layers[1].Cache).To(BeTrue())
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached module mod_hello"))
+			})
+		})
+
+		context("when the module cannot be built", func() {
+			it.Before(func() {
+				buildModule.BuildCall.Returns.Error = errors.New("failed to build module")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+					CNBPath:    cnbPath,
+				})
+				Expect(err).To(MatchError("failed to build module"))
+			})
+		})
+	})
+
+	context("when the app has no httpd.conf and the config is not generated", func() {
+		it("leaves the config to a later buildpack without checking it", func() {
+			result, err := build(packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{Name: "httpd"},
+					},
+				},
+				Platform: packit.Platform{Path: "platform"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers[0].Launch).To(BeTrue())
+			Expect(result.Layers[0].Build).To(BeFalse())
+			Expect(generateConfig.GenerateCall.CallCount).To(Equal(0))
+			Expect(checkConfig.CheckCall.CallCount).To(Equal(0))
+		})
+	})
+
 	context("when the layer metadata contains a cache match", func() {
 		it.Before(func() {
 			err := os.WriteFile(filepath.Join(layersDir, "httpd.toml"),
@@ -483,6 +990,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			entryResolver.MergeLayerTypesCall.Returns.Launch = true
+
+			Expect(os.MkdirAll(filepath.Join(layersDir, "httpd", "conf.d"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "httpd", "conf.d", "stale.conf"), nil, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "httpd.conf"), nil, 0644)).To(Succeed())
+
+			Expect(os.MkdirAll(filepath.Join(layersDir, "httpd", "env.launch"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "httpd", "env.launch", "HTTPD_FASTCGI_UPSTREAM.default"), []byte("fcgi://127.0.0.1:9000"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layersDir, "httpd", "env.launch", "HTTPD_CACHE_MAX_SIZE.default"), []byte("100M"), 0644)).To(Succeed())
 		})
 
 		it("reuses the layer", func() {
@@ -516,8 +1031,13 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(layer.Name).To(Equal("httpd"))
 			Expect(layer.Path).To(Equal(filepath.Join(layersDir, "httpd")))
 			Expect(layer.Build).To(BeFalse())
-			Expect(layer.Cache).To(BeFalse())
+			Expect(layer.Cache).To(BeTrue())
 			Expect(layer.Launch).To(BeTrue())
+			Expect(layer.ExecD).To(Equal([]string{filepath.Join(cnbPath, "bin", "configure-runtime")}))
+			Expect(layer.LaunchEnv).NotTo(HaveKey("HTTPD_FASTCGI_UPSTREAM.default"))
+			Expect(filepath.Join(layersDir, "httpd", "env.launch", "HTTPD_FASTCGI_UPSTREAM.default")).NotTo(BeAnExistingFile())
+			Expect(layer.LaunchEnv).NotTo(HaveKey("HTTPD_CACHE_MAX_SIZE.default"))
+			Expect(filepath.Join(layersDir, "httpd", "env.launch", "HTTPD_CACHE_MAX_SIZE.default")).NotTo(BeAnExistingFile())
 
 			Expect(result.Launch.BOM).To(Equal([]packit.BOMEntry{
 				{
@@ -536,8 +1056,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(result.Launch.Processes).To(Equal([]packit.Process{
 				{
 					Type:    "web",
-					Command: "httpd",
+					Command: filepath.Join(layersDir, "httpd", "bin", "start-httpd"),
 					Args: []string{
+						"httpd",
 						"-f",
 						filepath.Join(workingDir, "httpd.conf"),
 						"-k",
@@ -550,6 +1071,99 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			}))
 
 			Expect(dependencyService.DeliverCall.CallCount).To(Equal(0))
+
+			Expect(filepath.Join(layersDir, "httpd", "conf.d")).To(BeADirectory())
+			Expect(filepath.Join(layersDir, "httpd", "conf.d", "stale.conf")).NotTo(BeAnExistingFile())
+
+			Expect(checkConfig.CheckCall.CallCount).To(Equal(1))
+			Expect(checkConfig.CheckCall.Receives.ConfigPath).To(Equal(filepath.Join(workingDir, "httpd.conf")))
+			Expect(checkConfig.CheckCall.Receives.ServerRoot).To(Equal(filepath.Join(layersDir, "httpd")))
+		})
+	})
+
+	context("when the MPM and worker limits are set in the build environment", func() {
+		it.Before(func() {
+			err := os.WriteFile(filepath.Join(layersDir, "httpd.toml"),
+				[]byte("[metadata]\ncache_sha = \"some-sha\"\n"), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			build = httpd.Build(
+				httpd.BuildEnvironment{
+					MaxRequestWorkers: "150",
+					MPM:               "worker",
+					ThreadsPerChild:   "10",
+				},
+				entryResolver,
+				dependencyService,
+				generateConfig,
+				checkConfig,
+				buildModule,
+				sbomGenerator,
+				chronos.DefaultClock,
+				scribe.NewEmitter(buffer),
+			)
+		})
+
+		it("passes them on to the launch environment, even when the layer is reused", func() {
+			result, err := build(packit.BuildContext{
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "1.2.3",
+				},
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{Name: "httpd"},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(1))
+			Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
+				"HTTPD_MPM.override":                    "worker",
+				"BPL_HTTPD_MAX_REQUEST_WORKERS.default": "150",
+				"BPL_HTTPD_THREADS_PER_CHILD.default":   "10",
+			}))
+			Expect(dependencyService.DeliverCall.CallCount).To(Equal(0))
+		})
+
+		context("failure cases", func() {
+			var buildContext packit.BuildContext
+
+			it.Before(func() {
+				buildContext = packit.BuildContext{
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "1.2.3",
+					},
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+					CNBPath:    cnbPath,
+					Stack:      "some-stack",
+				}
+			})
+
+			context("when BP_HTTPD_MAX_REQUEST_WORKERS is not a positive integer", func() {
+				it("returns an error", func() {
+					_, err := httpd.Build(httpd.BuildEnvironment{
+						MaxRequestWorkers: "abc",
+					}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+					Expect(err).To(MatchError("failed: BP_HTTPD_MAX_REQUEST_WORKERS must be 'auto' or a positive integer, got 'abc'"))
+				})
+			})
+
+			context("when BP_HTTPD_THREADS_PER_CHILD is not a positive integer", func() {
+				it("returns an error", func() {
+					_, err := httpd.Build(httpd.BuildEnvironment{
+						ThreadsPerChild: "0",
+					}, entryResolver, dependencyService, generateConfig, checkConfig, buildModule, sbomGenerator, chronos.DefaultClock, scribe.NewEmitter(buffer))(buildContext)
+					Expect(err).To(MatchError("failed: BP_HTTPD_THREADS_PER_CHILD must be 'auto' or a positive integer, got '0'"))
+				})
+			})
 		})
 	})
 
@@ -562,6 +1176,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				entryResolver,
 				dependencyService,
 				generateConfig,
+				checkConfig,
+				buildModule,
 				sbomGenerator,
 				chronos.DefaultClock,
 				scribe.NewEmitter(buffer),
@@ -597,10 +1213,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					Type:    "web",
 					Command: "watchexec",
 					Args: []string{
-						"--restart",
+						"--signal", "SIGUSR1",
 						"--watch", workingDir,
+						"--filter", "**/*.conf",
+						"--filter", "**/_redirects",
+						"--filter", "**/_headers",
 						"--shell", "none",
 						"--",
+						filepath.Join(layersDir, "httpd", "bin", "start-httpd"),
 						"httpd",
 						"-f",
 						filepath.Join(workingDir, "httpd.conf"),
@@ -613,8 +1233,9 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				},
 				{
 					Type:    "no-reload",
-					Command: "httpd",
+					Command: filepath.Join(layersDir, "httpd", "bin", "start-httpd"),
 					Args: []string{
+						"httpd",
 						"-f",
 						filepath.Join(workingDir, "httpd.conf"),
 						"-k",
@@ -627,6 +1248,51 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when BP_LIVE_RELOAD_IGNORE_PATTERNS is set in the build environment", func() {
+		it.Before(func() {
+			build = httpd.Build(
+				httpd.BuildEnvironment{
+					Reload:               true,
+					ReloadIgnorePatterns: "**/vendor/**, tmp/*.conf",
+				},
+				entryResolver,
+				dependencyService,
+				generateConfig,
+				checkConfig,
+				buildModule,
+				sbomGenerator,
+				chronos.DefaultClock,
+				scribe.NewEmitter(buffer),
+			)
+		})
+
+		it("passes the ignore patterns to watchexec", func() {
+			result, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+				CNBPath:    cnbPath,
+				Stack:      "some-stack",
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{Name: "httpd"},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Launch.Processes[0].Command).To(Equal("watchexec"))
+			Expect(result.Launch.Processes[0].Args[:16]).To(Equal([]string{
+				"--signal", "SIGUSR1",
+				"--watch", workingDir,
+				"--filter", "**/*.conf",
+				"--filter", "**/_redirects",
+				"--filter", "**/_headers",
+				"--ignore", "**/vendor/**",
+				"--ignore", "tmp/*.conf",
+				"--shell", "none",
+			}))
+		})
+	})
+
 	context("failure cases", func() {
 		context("when the httpd layer cannot be retrieved", func() {
 			it.Before(func() {
@@ -669,6 +1335,8 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					entryResolver,
 					dependencyService,
 					generateConfig,
+					checkConfig,
+					buildModule,
 					sbomGenerator,
 					chronos.DefaultClock,
 					scribe.NewEmitter(buffer),
@@ -685,6 +1353,37 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the launch wrapper cannot be copied into the layer", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(cnbPath, "bin", "start-httpd"))).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+					CNBPath:    cnbPath,
+				})
+				Expect(err).To(MatchError(ContainSubstring("start-httpd")))
+			})
+		})
+
+		context("when the config check fails", func() {
+			it.Before(func() {
+				checkConfig.CheckCall.Returns.Error = errors.New("failed to check config")
+				Expect(os.WriteFile(filepath.Join(workingDir, "httpd.conf"), nil, 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+					CNBPath:    cnbPath,
+				})
+				Expect(err).To(MatchError("failed to check config"))
+			})
+		})
+
 		context("when the dependency cannot be installed", func() {
 			it.Before(func() {
 				dependencyService.DeliverCall.Returns.Error = errors.New("failed to install dependency")
@@ -0,0 +1,77 @@
+package httpd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultCacheMaxSize is the size that the disk cache is kept under when
+// BP_WEB_SERVER_CACHE_MAX_SIZE is not set.
+const DefaultCacheMaxSize = "100M"
+
+var cacheMaxSizePattern = regexp.MustCompile(`^[0-9]+[BKMG]?$`)
+
+// cacheMaxSize returns the size that the disk cache is kept under at launch,
+// which is empty when BP_WEB_SERVER_CACHE_PATHS does not name any path.
+func (e BuildEnvironment) cacheMaxSize() (string, error) {
+	paths, err := parseCachePaths(e.CachePaths, []string{""})
+	if err != nil {
+		return "", err
+	}
+
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	size := e.CacheMaxSize
+	if size == "" {
+		size = DefaultCacheMaxSize
+	}
+
+	if !cacheMaxSizePattern.MatchString(size) {
+		return "", fmt.Errorf("failed: BP_WEB_SERVER_CACHE_MAX_SIZE must be a number of bytes with an optional 'K', 'M' or 'G' suffix, got '%s'", size)
+	}
+
+	return size, nil
+}
+
+// parseCachePaths reads the URL path prefixes of BP_WEB_SERVER_CACHE_PATHS.
+// Only the responses of upstreams are cached, so every path must fall under
+// one of the given proxied prefixes, where an empty prefix proxies any path.
+func parseCachePaths(value string, proxied []string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("failed: BP_WEB_SERVER_CACHE_PATHS must be a comma separated list of URL paths, got '%s'", path)
+		}
+
+		path = normalizeURLPath(path)
+
+		var ok bool
+		for _, prefix := range proxied {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("failed: BP_WEB_SERVER_CACHE_PATHS must only contain proxied paths, but the requests under '%s/' are not passed to an upstream", path)
+		}
+
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,177 @@
+package httpd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/httpd/httpdconf"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+//go:generate faux --interface Executable --output fakes/executable.go
+type Executable interface {
+	Execute(execution pexec.Execution) error
+}
+
+// ConfigBindingType is the type of the service bindings whose *.conf entries
+// are included in the configuration of httpd when it starts.
+const ConfigBindingType = "httpd-config"
+
+type CheckHTTPDConfig struct {
+	executable      Executable
+	bindingResolver BindingResolver
+	logger          scribe.Emitter
+}
+
+func NewCheckHTTPDConfig(executable Executable, bindingResolver BindingResolver, logger scribe.Emitter) CheckHTTPDConfig {
+	return CheckHTTPDConfig{
+		executable:      executable,
+		bindingResolver: bindingResolver,
+		logger:          logger,
+	}
+}
+
+// Check analyzes the given config file for settings that do not work in a
+// container, and then runs the httpd installed at serverRoot in config-test
+// mode against it. The variables that are only set when the app starts are
+// replaced with stand-in values, so that the config can be parsed during the
+// build. The fragments of the httpd-config bindings that are present during
+// the build are checked along with the config, the same way that they are
+// included when the app starts.
+func (c CheckHTTPDConfig) Check(configPath, appRoot, serverRoot, platformPath string) error {
+	c.logger.Process("Checking httpd configuration")
+
+	bindings, err := c.bindingResolver.Resolve(ConfigBindingType, "", platformPath)
+	if err != nil {
+		return err
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].Name < bindings[j].Name })
+
+	paths := []string{configPath}
+	args := []string{"-t", "-f", configPath}
+	for _, binding := range bindings {
+		fragments, err := filepath.Glob(filepath.Join(binding.Path, "*.conf"))
+		if err != nil {
+			return err
+		}
+
+		if len(fragments) == 0 {
+			c.logger.Subprocess("WARNING: Binding '%s' of type '%s' does not contain any *.conf entries", binding.Name, ConfigBindingType)
+			continue
+		}
+
+		c.logger.Subprocess("Including the fragments of binding '%s' of type '%s'", binding.Name, ConfigBindingType)
+		paths = append(paths, fragments...)
+		args = append(args, "-c", fmt.Sprintf("IncludeOptional %q", filepath.Join(binding.Path, "*.conf")))
+	}
+
+	standIns := map[string]string{
+		"PORT":              "8080",
+		"APP_ROOT":          appRoot,
+		"SERVER_ROOT":       serverRoot,
+		"HTTPD_CONF_D":      filepath.Join(serverRoot, DropInConfDir),
+		"HTTPD_RUNTIME_DIR": os.TempDir(),
+		"HTTPD_USER":        fmt.Sprintf("#%d", os.Geteuid()),
+		"HTTPD_CACHE_ROOT":  os.TempDir(),
+
+		// The FastCGI upstream is not contacted during the check.
+		"HTTPD_FASTCGI_UPSTREAM": "fcgi://127.0.0.1:9000",
+
+		// These match the values that are used at launch when the container
+		// has no memory or CPU limit.
+		"HTTPD_THREADS_PER_CHILD":   "25",
+		"HTTPD_MAX_REQUEST_WORKERS": "400",
+		"HTTPD_SERVER_LIMIT":        "24",
+	}
+
+	err = c.lint(paths, appRoot, serverRoot, standIns)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		fmt.Sprintf("PATH=%s%c%s", filepath.Join(serverRoot, "bin"), os.PathListSeparator, os.Getenv("PATH")),
+		fmt.Sprintf("LD_LIBRARY_PATH=%s%c%s", filepath.Join(serverRoot, "lib"), os.PathListSeparator, os.Getenv("LD_LIBRARY_PATH")),
+	)
+	for _, name := range sortedKeys(standIns) {
+		env = append(env, fmt.Sprintf("%s=%s", name, standIns[name]))
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err = c.executable.Execute(pexec.Execution{
+		Args:   args,
+		Env:    env,
+		Stdout: buffer,
+		Stderr: buffer,
+	})
+
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line != "" {
+			c.logger.Subprocess("%s", line)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed: httpd configuration test failed for '%s': %w", configPath, err)
+	}
+
+	c.logger.Break()
+
+	return nil
+}
+
+// lint reports the problems that lintHTTPDConfig finds in the config files
+// and fails when any of them would keep the server from starting. A config
+// file that cannot be parsed is left for httpd to diagnose.
+func (c CheckHTTPDConfig) lint(paths []string, appRoot, serverRoot string, env map[string]string) error {
+	var diagnostics []diagnostic
+	for _, path := range paths {
+		file, err := httpdconf.NewParser(serverRoot, env).ParseFile(path)
+		if err != nil {
+			c.logger.Subprocess("WARNING: Skipping analysis of the configuration: %s", err)
+			continue
+		}
+
+		found, err := lintHTTPDConfig(file, appRoot, serverRoot, env)
+		if err != nil {
+			return err
+		}
+
+		diagnostics = append(diagnostics, found...)
+	}
+
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	c.logger.Subprocess("Found %d problem(s) in the configuration:", len(diagnostics))
+
+	var errorCount int
+	for _, d := range diagnostics {
+		c.logger.Action("%s", d)
+		if d.Error {
+			errorCount++
+		}
+	}
+	c.logger.Break()
+
+	if errorCount > 0 {
+		return fmt.Errorf("failed: the httpd configuration has %d error(s) that keep the server from starting", errorCount)
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
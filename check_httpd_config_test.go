@@ -0,0 +1,248 @@
+package httpd_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd"
+	"github.com/paketo-buildpacks/httpd/fakes"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCheckHTTPDConfig(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		appRoot    string
+		serverRoot string
+		configPath string
+
+		checkHTTPDConfig httpd.CheckHTTPDConfig
+
+		executable      *fakes.Executable
+		bindingResolver *fakes.BindingResolver
+
+		buffer *bytes.Buffer
+	)
+
+	it.Before(func() {
+		var err error
+		appRoot, err = os.MkdirTemp("", "app-root")
+		Expect(err).NotTo(HaveOccurred())
+
+		serverRoot, err = os.MkdirTemp("", "server-root")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(serverRoot, "modules"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(serverRoot, "modules", "mod_mpm_event.so"), nil, 0644)).To(Succeed())
+
+		configPath = filepath.Join(appRoot, "httpd.conf")
+		Expect(os.WriteFile(configPath, []byte(`ServerRoot "${SERVER_ROOT}"
+LoadModule mpm_event_module modules/mod_mpm_event.so
+User "${HTTPD_USER}"
+Listen "${PORT}"
+ErrorLog /proc/self/fd/2
+`), 0644)).To(Succeed())
+
+		buffer = bytes.NewBuffer(nil)
+
+		executable = &fakes.Executable{}
+		executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+			fmt.Fprintln(execution.Stderr, "Syntax OK")
+			return nil
+		}
+
+		bindingResolver = &fakes.BindingResolver{}
+
+		checkHTTPDConfig = httpd.NewCheckHTTPDConfig(executable, bindingResolver, scribe.NewEmitter(buffer))
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(appRoot)).To(Succeed())
+		Expect(os.RemoveAll(serverRoot)).To(Succeed())
+	})
+
+	context("Check", func() {
+		it("runs httpd in config-test mode with stand-in launch variables", func() {
+			err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+			Expect(err).NotTo(HaveOccurred())
+
+			execution := executable.ExecuteCall.Receives.Execution
+			Expect(execution.Args).To(Equal([]string{"-t", "-f", configPath}))
+			Expect(execution.Env).To(ContainElements(
+				MatchRegexp(fmt.Sprintf(`^PATH=%s:`, filepath.Join(serverRoot, "bin"))),
+				MatchRegexp(fmt.Sprintf(`^LD_LIBRARY_PATH=%s:`, filepath.Join(serverRoot, "lib"))),
+				"PORT=8080",
+				fmt.Sprintf("APP_ROOT=%s", appRoot),
+				fmt.Sprintf("SERVER_ROOT=%s", serverRoot),
+				fmt.Sprintf("HTTPD_RUNTIME_DIR=%s", os.TempDir()),
+				fmt.Sprintf("HTTPD_USER=#%d", os.Geteuid()),
+				"HTTPD_THREADS_PER_CHILD=25",
+				"HTTPD_MAX_REQUEST_WORKERS=400",
+				"HTTPD_SERVER_LIMIT=24",
+			))
+
+			Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("httpd-config"))
+			Expect(bindingResolver.ResolveCall.Receives.Provider).To(Equal(""))
+			Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("platform"))
+
+			Expect(buffer.String()).To(ContainSubstring("Checking httpd configuration"))
+			Expect(buffer.String()).To(ContainSubstring("Syntax OK"))
+			Expect(buffer.String()).NotTo(ContainSubstring("problem"))
+		})
+
+		context("when httpd-config bindings are present", func() {
+			var bindingsDir string
+
+			it.Before(func() {
+				var err error
+				bindingsDir, err = os.MkdirTemp("", "bindings")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.MkdirAll(filepath.Join(bindingsDir, "org-policy"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(bindingsDir, "org-policy", "type"), []byte("httpd-config"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(bindingsDir, "org-policy", "logs.conf"), []byte("CustomLog logs/access.log common\n"), 0644)).To(Succeed())
+
+				Expect(os.MkdirAll(filepath.Join(bindingsDir, "empty"), os.ModePerm)).To(Succeed())
+
+				bindingResolver.ResolveCall.Returns.BindingSlice = []servicebindings.Binding{
+					{
+						Name: "org-policy",
+						Type: "httpd-config",
+						Path: filepath.Join(bindingsDir, "org-policy"),
+						Entries: map[string]*servicebindings.Entry{
+							"logs.conf": servicebindings.NewEntry(filepath.Join(bindingsDir, "org-policy", "logs.conf")),
+						},
+					},
+					{
+						Name: "empty",
+						Type: "httpd-config",
+						Path: filepath.Join(bindingsDir, "empty"),
+					},
+				}
+			})
+
+			it.After(func() {
+				Expect(os.RemoveAll(bindingsDir)).To(Succeed())
+			})
+
+			it("checks their fragments along with the config", func() {
+				err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executable.ExecuteCall.Receives.Execution.Args).To(Equal([]string{
+					"-t", "-f", configPath,
+					"-c", fmt.Sprintf("IncludeOptional %q", filepath.Join(bindingsDir, "org-policy", "*.conf")),
+				}))
+
+				Expect(buffer.String()).To(ContainSubstring("WARNING: Binding 'empty' of type 'httpd-config' does not contain any *.conf entries"))
+				Expect(buffer.String()).To(ContainSubstring("Including the fragments of binding 'org-policy' of type 'httpd-config'"))
+				Expect(buffer.String()).To(ContainSubstring(filepath.Join(bindingsDir, "org-policy", "logs.conf") + ":1: warning: CustomLog writes to logs/access.log"))
+			})
+		})
+
+		context("when the config does not follow the container contract", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(appRoot, "conf.d"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(appRoot, "conf.d", "logs.conf"), []byte(`CustomLog "|/usr/bin/rotatelogs access.log 86400" common
+TransferLog logs/transfer.log
+`), 0644)).To(Succeed())
+
+				Expect(os.WriteFile(configPath, []byte(`ServerRoot "/etc/httpd"
+Listen 80
+User apache
+Group apache
+ErrorLog logs/error_log
+Include ${APP_ROOT}/conf.d/*.conf
+`), 0644)).To(Succeed())
+			})
+
+			it("reports warnings with their positions and still runs httpd", func() {
+				err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Found 6 problem(s) in the configuration:"))
+				Expect(buffer.String()).To(ContainSubstring("httpd.conf:1: warning: ServerRoot /etc/httpd does not point at ${SERVER_ROOT}"))
+				Expect(buffer.String()).To(ContainSubstring("httpd.conf:2: warning: Listen 80 does not use ${PORT}"))
+				Expect(buffer.String()).To(ContainSubstring("httpd.conf:3: warning: User apache only takes effect when the server starts as root"))
+				Expect(buffer.String()).To(ContainSubstring("httpd.conf:4: warning: Group apache only takes effect when the server starts as root"))
+				Expect(buffer.String()).To(ContainSubstring("httpd.conf:5: warning: ErrorLog writes to logs/error_log"))
+				Expect(buffer.String()).To(ContainSubstring("conf.d/logs.conf:2: warning: TransferLog writes to logs/transfer.log"))
+				Expect(buffer.String()).NotTo(ContainSubstring("CustomLog"))
+
+				Expect(executable.ExecuteCall.CallCount).To(Equal(1))
+			})
+		})
+
+		context("when the config cannot be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(configPath, []byte("<Directory />\n"), 0644)).To(Succeed())
+			})
+
+			it("skips the analysis and leaves the diagnosis to httpd", func() {
+				err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("WARNING: Skipping analysis of the configuration: " + configPath + ":1: <Directory> section is never closed"))
+				Expect(executable.ExecuteCall.CallCount).To(Equal(1))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the config loads a module that is not installed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(configPath, []byte(`Listen ${PORT}
+LoadModule mpm_event_module modules/mod_mpm_event.so
+LoadModule php7_module modules/libphp7.so
+`), 0644)).To(Succeed())
+				})
+
+				it("returns an error without running httpd", func() {
+					err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+					Expect(err).To(MatchError("failed: the httpd configuration has 1 error(s) that keep the server from starting"))
+
+					Expect(buffer.String()).To(ContainSubstring("httpd.conf:3: error: LoadModule php7_module refers to modules/libphp7.so, which the installed Apache HTTP Server does not provide"))
+					Expect(executable.ExecuteCall.CallCount).To(Equal(0))
+				})
+			})
+
+			context("when the binding resolver fails", func() {
+				it.Before(func() {
+					bindingResolver.ResolveCall.Returns.Error = errors.New("failed to resolve bindings")
+				})
+
+				it("returns an error", func() {
+					err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+					Expect(err).To(MatchError("failed to resolve bindings"))
+				})
+			})
+
+			context("when httpd rejects the config", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						fmt.Fprintln(execution.Stderr, "AH00526: Syntax error on line 3 of /workspace/httpd.conf:")
+						fmt.Fprintln(execution.Stderr, "Invalid command 'Lisen', perhaps misspelled")
+						return errors.New("exit status 1")
+					}
+				})
+
+				it("returns an error and prints the diagnostics of httpd", func() {
+					err := checkHTTPDConfig.Check(configPath, appRoot, serverRoot, "platform")
+					Expect(err).To(MatchError(fmt.Sprintf("failed: httpd configuration test failed for '%s': exit status 1", configPath)))
+
+					Expect(buffer.String()).To(ContainSubstring("    AH00526: Syntax error on line 3 of /workspace/httpd.conf:\n"))
+					Expect(buffer.String()).To(ContainSubstring("    Invalid command 'Lisen', perhaps misspelled\n"))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// unlimitedMemory is the threshold above which a cgroup v1 memory limit is
+// treated as unset. The kernel reports a page-aligned maximum int64 instead of
+// the "max" keyword used by cgroup v2.
+const unlimitedMemory = int64(1) << 62
+
+// MemoryLimit returns the memory limit in bytes of the cgroup mounted at the
+// given root, supporting both cgroup v2 and v1 hierarchies. The second return
+// value is false when no limit is set.
+func MemoryLimit(cgroupRoot string) (int64, bool, error) {
+	for _, path := range []string{
+		filepath.Join(cgroupRoot, "memory.max"),
+		filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"),
+	} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return 0, false, err
+		}
+
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, false, nil
+		}
+
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if limit >= unlimitedMemory {
+			return 0, false, nil
+		}
+
+		return limit, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// CPULimit returns the number of CPUs that the cgroup mounted at the given
+// root may use, supporting both cgroup v2 and v1 hierarchies. The second
+// return value is false when no quota is set.
+func CPULimit(cgroupRoot string) (float64, bool, error) {
+	content, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false, nil
+		}
+
+		return quota(fields[0], fields[1])
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, false, err
+	}
+
+	quotaContent, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	periodContent, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if strings.TrimSpace(string(quotaContent)) == "-1" {
+		return 0, false, nil
+	}
+
+	return quota(strings.TrimSpace(string(quotaContent)), strings.TrimSpace(string(periodContent)))
+}
+
+func quota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if q <= 0 || p <= 0 {
+		return 0, false, nil
+	}
+
+	return q / p, true, nil
+}
@@ -0,0 +1,15 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitConfigureRuntime(t *testing.T) {
+	suite := spec.New("cmd/configure-runtime/internal", spec.Report(report.Terminal{}))
+	suite("Run", testRun)
+	suite("SizeWorkers", testSizeWorkers)
+	suite.Run(t)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRuntimeDir is used for the PID file, mutexes and the scoreboard when
+// HTTPD_RUNTIME_DIR is not set in the launch environment.
+const DefaultRuntimeDir = "/tmp"
+
+// CacheDir is the directory in the runtime directory that holds the disk
+// cache of the generated config.
+const CacheDir = "cache"
+
+// Run is executed as an exec.d helper before httpd starts. It makes sure that
+// the runtime directory exists and exports the user that httpd should switch
+// to. Only the root user is able to switch users, so any other user, such as
+// an arbitrary UID assigned by the platform, keeps running as itself. It also
+// exports MPM worker limits sized for the cgroup mounted at cgroupRoot. When
+// HTTPD_CACHE_MAX_SIZE is set, it creates the disk cache directory and
+// exports it as HTTPD_CACHE_ROOT.
+func Run(environ []string, uid int, cgroupRoot string, output io.Writer) error {
+	env := map[string]string{}
+	for _, variable := range environ {
+		key, value, _ := strings.Cut(variable, "=")
+		env[key] = value
+	}
+
+	runtimeDir := env["HTTPD_RUNTIME_DIR"]
+	if runtimeDir == "" {
+		runtimeDir = DefaultRuntimeDir
+	}
+
+	err := os.MkdirAll(runtimeDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create httpd runtime directory: %w", err)
+	}
+
+	user := "nobody"
+	if uid != 0 {
+		user = fmt.Sprintf("#%d", uid)
+	}
+
+	if env["HTTPD_CACHE_MAX_SIZE"] != "" {
+		cacheRoot := filepath.Join(runtimeDir, CacheDir)
+		err = os.MkdirAll(cacheRoot, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create httpd cache directory: %w", err)
+		}
+
+		// httpd writes to the cache as the user that it switches to, which
+		// does not own the directory when it is created by root.
+		err = os.Chmod(cacheRoot, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create httpd cache directory: %w", err)
+		}
+
+		_, err = fmt.Fprintf(output, "HTTPD_CACHE_ROOT = %q\n", cacheRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	workers, err := SizeWorkers(env, cgroupRoot)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(output, "HTTPD_RUNTIME_DIR = %q\nHTTPD_USER = %q\n", runtimeDir, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(output, "HTTPD_THREADS_PER_CHILD = \"%d\"\nHTTPD_MAX_REQUEST_WORKERS = \"%d\"\nHTTPD_SERVER_LIMIT = \"%d\"\n",
+		workers.ThreadsPerChild, workers.MaxRequestWorkers, workers.ServerLimit)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
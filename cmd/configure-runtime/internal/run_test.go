@@ -0,0 +1,130 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd/cmd/configure-runtime/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRun(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		runtimeDir string
+		cgroupRoot string
+		buffer     *bytes.Buffer
+	)
+
+	it.Before(func() {
+		var err error
+		runtimeDir, err = os.MkdirTemp("", "runtime-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		runtimeDir = filepath.Join(runtimeDir, "httpd")
+
+		cgroupRoot, err = os.MkdirTemp("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = bytes.NewBuffer(nil)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(filepath.Dir(runtimeDir))).To(Succeed())
+		Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
+	})
+
+	context("when running as root", func() {
+		it("switches to the nobody user", func() {
+			err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir}, 0, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_USER = "nobody"`))
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_RUNTIME_DIR = "` + runtimeDir + `"`))
+			Expect(runtimeDir).To(BeADirectory())
+		})
+	})
+
+	context("when running as an arbitrary non-root user", func() {
+		it("keeps running as that user", func() {
+			err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir}, 1000680000, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_USER = "#1000680000"`))
+		})
+	})
+
+	context("when the runtime directory is not set", func() {
+		it("uses the default runtime directory", func() {
+			err := internal.Run(nil, 1000, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_RUNTIME_DIR = "/tmp"`))
+		})
+	})
+
+	context("when HTTPD_CACHE_MAX_SIZE is set", func() {
+		it("creates the cache directory that every user can write to", func() {
+			err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir, "HTTPD_CACHE_MAX_SIZE=100M"}, 0, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			cacheRoot := filepath.Join(runtimeDir, "cache")
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_CACHE_ROOT = "` + cacheRoot + `"`))
+
+			info, err := os.Stat(cacheRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+			Expect(info.Mode().Perm()).To(Equal(os.ModePerm))
+		})
+	})
+
+	context("when HTTPD_CACHE_MAX_SIZE is empty", func() {
+		it("does not create a cache directory", func() {
+			err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir, "HTTPD_CACHE_MAX_SIZE="}, 0, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).NotTo(ContainSubstring("HTTPD_CACHE_ROOT"))
+			Expect(filepath.Join(runtimeDir, "cache")).NotTo(BeADirectory())
+		})
+	})
+
+	context("when the container has a memory limit", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("268435456\n"), 0600)).To(Succeed())
+		})
+
+		it("exports worker limits sized for that limit", func() {
+			err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir}, 0, cgroupRoot, buffer)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_THREADS_PER_CHILD = "25"`))
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_MAX_REQUEST_WORKERS = "75"`))
+			Expect(buffer.String()).To(ContainSubstring(`HTTPD_SERVER_LIMIT = "5"`))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the runtime directory cannot be created", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Dir(runtimeDir)+"/file", nil, 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + filepath.Join(filepath.Dir(runtimeDir), "file", "httpd")}, 0, cgroupRoot, buffer)
+				Expect(err).To(MatchError(ContainSubstring("failed to create httpd runtime directory")))
+			})
+		})
+
+		context("when the worker configuration is invalid", func() {
+			it("returns an error", func() {
+				err := internal.Run([]string{"HTTPD_RUNTIME_DIR=" + runtimeDir, "BPL_HTTPD_THREADS_PER_CHILD=many"}, 0, cgroupRoot, buffer)
+				Expect(err).To(MatchError(`failed to parse BPL_HTTPD_THREADS_PER_CHILD: "many" is not a positive integer or 'auto'`))
+			})
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	// DefaultThreadsPerChild matches the httpd default for threaded MPMs.
+	DefaultThreadsPerChild = 25
+
+	// DefaultMaxRequestWorkers matches the httpd default for threaded MPMs and
+	// is used when the container has neither a memory nor a CPU limit.
+	DefaultMaxRequestWorkers = 400
+
+	// MemoryPerWorker is the amount of memory budgeted for each request worker
+	// when sizing MaxRequestWorkers from the container memory limit.
+	MemoryPerWorker = 2 * 1024 * 1024
+
+	// WorkersPerCPU caps MaxRequestWorkers by the container CPU quota.
+	WorkersPerCPU = 100
+
+	// DefaultPreforkMaxRequestWorkers matches the httpd default for the
+	// prefork MPM.
+	DefaultPreforkMaxRequestWorkers = 256
+
+	// MemoryPerPreforkWorker is the amount of memory budgeted for each
+	// request worker under the prefork MPM, where every worker is a process.
+	MemoryPerPreforkWorker = 16 * 1024 * 1024
+)
+
+// Workers holds the MPM directives exported to the httpd configuration.
+type Workers struct {
+	ThreadsPerChild   int
+	MaxRequestWorkers int
+	ServerLimit       int
+}
+
+// SizeWorkers computes the MPM worker limits for the cgroup mounted at the
+// given root. A quarter of the memory limit is left as headroom for the
+// parent process and per-child overhead. Explicit values for
+// BPL_HTTPD_THREADS_PER_CHILD and BPL_HTTPD_MAX_REQUEST_WORKERS take
+// precedence over the computed ones, unless they are set to "auto". When
+// HTTPD_MPM is "prefork", every child serves a single request and is budgeted
+// more memory. The threaded MPMs get half again as many children in
+// ServerLimit as MaxRequestWorkers needs.
+func SizeWorkers(env map[string]string, cgroupRoot string) (Workers, error) {
+	workers := Workers{ThreadsPerChild: DefaultThreadsPerChild}
+	defaultMaxRequestWorkers, memoryPerWorker := DefaultMaxRequestWorkers, MemoryPerWorker
+
+	prefork := env["HTTPD_MPM"] == "prefork"
+	if prefork {
+		workers.ThreadsPerChild = 1
+		defaultMaxRequestWorkers, memoryPerWorker = DefaultPreforkMaxRequestWorkers, MemoryPerPreforkWorker
+	}
+
+	if value := env["BPL_HTTPD_THREADS_PER_CHILD"]; !prefork && value != "" && value != "auto" {
+		threads, err := strconv.Atoi(value)
+		if err != nil || threads < 1 {
+			return Workers{}, fmt.Errorf("failed to parse BPL_HTTPD_THREADS_PER_CHILD: %q is not a positive integer or 'auto'", value)
+		}
+		workers.ThreadsPerChild = threads
+	}
+
+	if value := env["BPL_HTTPD_MAX_REQUEST_WORKERS"]; value != "" && value != "auto" {
+		maxRequestWorkers, err := strconv.Atoi(value)
+		if err != nil || maxRequestWorkers < 1 {
+			return Workers{}, fmt.Errorf("failed to parse BPL_HTTPD_MAX_REQUEST_WORKERS: %q is not a positive integer or 'auto'", value)
+		}
+		workers.MaxRequestWorkers = maxRequestWorkers
+	} else {
+		maxRequestWorkers := defaultMaxRequestWorkers
+
+		memory, ok, err := MemoryLimit(cgroupRoot)
+		if err != nil {
+			return Workers{}, fmt.Errorf("failed to read cgroup memory limit: %w", err)
+		}
+		if ok {
+			maxRequestWorkers = min(maxRequestWorkers, int(memory*3/4/int64(memoryPerWorker)))
+		}
+
+		cpus, ok, err := CPULimit(cgroupRoot)
+		if err != nil {
+			return Workers{}, fmt.Errorf("failed to read cgroup CPU limit: %w", err)
+		}
+		if ok {
+			maxRequestWorkers = min(maxRequestWorkers, int(math.Ceil(cpus*WorkersPerCPU)))
+		}
+
+		// Every child process runs a fixed number of threads, so the limit is
+		// rounded down to whole children while keeping at least one.
+		workers.MaxRequestWorkers = max(workers.ThreadsPerChild, maxRequestWorkers/workers.ThreadsPerChild*workers.ThreadsPerChild)
+	}
+
+	workers.ServerLimit = (workers.MaxRequestWorkers + workers.ThreadsPerChild - 1) / workers.ThreadsPerChild
+
+	// The threaded MPMs keep the children that are finishing their requests
+	// after a graceful restart or stop in the scoreboard, so spare slots are
+	// left for the children that replace them.
+	if !prefork {
+		workers.ServerLimit += (workers.ServerLimit + 1) / 2
+	}
+
+	return workers, nil
+}
@@ -0,0 +1,204 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd/cmd/configure-runtime/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSizeWorkers(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		cgroupRoot string
+	)
+
+	it.Before(func() {
+		var err error
+		cgroupRoot, err = os.MkdirTemp("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
+	})
+
+	context("when the container has no limits", func() {
+		it("uses the httpd defaults", func() {
+			workers, err := internal.SizeWorkers(nil, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers).To(Equal(internal.Workers{
+				ThreadsPerChild:   25,
+				MaxRequestWorkers: 400,
+				ServerLimit:       24,
+			}))
+		})
+	})
+
+	context("when cgroup v2 limits are set", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("1073741824\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("150000 100000\n"), 0600)).To(Succeed())
+		})
+
+		it("sizes the workers from the smaller of the memory and CPU limits", func() {
+			workers, err := internal.SizeWorkers(nil, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers).To(Equal(internal.Workers{
+				ThreadsPerChild:   25,
+				MaxRequestWorkers: 150,
+				ServerLimit:       9,
+			}))
+		})
+	})
+
+	context("when the cgroup v2 limits are unset", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("max\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("max 100000\n"), 0600)).To(Succeed())
+		})
+
+		it("uses the httpd defaults", func() {
+			workers, err := internal.SizeWorkers(nil, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers.MaxRequestWorkers).To(Equal(400))
+		})
+	})
+
+	context("when cgroup v1 limits are set", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "memory"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "cpu"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"), []byte("134217728\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"), []byte("-1\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0600)).To(Succeed())
+		})
+
+		it("sizes the workers from the memory limit", func() {
+			workers, err := internal.SizeWorkers(nil, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers).To(Equal(internal.Workers{
+				ThreadsPerChild:   25,
+				MaxRequestWorkers: 25,
+				ServerLimit:       2,
+			}))
+		})
+	})
+
+	context("when the cgroup v1 memory limit is unset", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(cgroupRoot, "memory"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0600)).To(Succeed())
+		})
+
+		it("uses the httpd defaults", func() {
+			workers, err := internal.SizeWorkers(nil, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers.MaxRequestWorkers).To(Equal(400))
+		})
+	})
+
+	context("when the worker limits are configured", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("134217728\n"), 0600)).To(Succeed())
+		})
+
+		it("uses the configured values", func() {
+			workers, err := internal.SizeWorkers(map[string]string{
+				"BPL_HTTPD_THREADS_PER_CHILD":   "10",
+				"BPL_HTTPD_MAX_REQUEST_WORKERS": "35",
+			}, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers).To(Equal(internal.Workers{
+				ThreadsPerChild:   10,
+				MaxRequestWorkers: 35,
+				ServerLimit:       6,
+			}))
+		})
+
+		context("when only the threads per child are configured", func() {
+			it("sizes the workers in whole children", func() {
+				workers, err := internal.SizeWorkers(map[string]string{
+					"BPL_HTTPD_THREADS_PER_CHILD":   "20",
+					"BPL_HTTPD_MAX_REQUEST_WORKERS": "auto",
+				}, cgroupRoot)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(workers).To(Equal(internal.Workers{
+					ThreadsPerChild:   20,
+					MaxRequestWorkers: 40,
+					ServerLimit:       3,
+				}))
+			})
+		})
+	})
+
+	context("when a threaded MPM is restarted gracefully", func() {
+		it("leaves spare scoreboard slots for the children that replace the ones that finish their requests", func() {
+			workers, err := internal.SizeWorkers(map[string]string{
+				"BPL_HTTPD_THREADS_PER_CHILD":   "25",
+				"BPL_HTTPD_MAX_REQUEST_WORKERS": "100",
+			}, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+
+			children := workers.MaxRequestWorkers / workers.ThreadsPerChild
+			Expect(children).To(Equal(4))
+			Expect(workers.ServerLimit).To(Equal(6))
+		})
+	})
+
+	context("when the prefork MPM is selected", func() {
+		it("uses the prefork defaults with a single thread per child", func() {
+			workers, err := internal.SizeWorkers(map[string]string{
+				"HTTPD_MPM":                   "prefork",
+				"BPL_HTTPD_THREADS_PER_CHILD": "10",
+			}, cgroupRoot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workers).To(Equal(internal.Workers{
+				ThreadsPerChild:   1,
+				MaxRequestWorkers: 256,
+				ServerLimit:       256,
+			}))
+		})
+
+		context("when a memory limit is set", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("1073741824\n"), 0600)).To(Succeed())
+			})
+
+			it("budgets more memory for every worker", func() {
+				workers, err := internal.SizeWorkers(map[string]string{"HTTPD_MPM": "prefork"}, cgroupRoot)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(workers).To(Equal(internal.Workers{
+					ThreadsPerChild:   1,
+					MaxRequestWorkers: 48,
+					ServerLimit:       48,
+				}))
+			})
+		})
+	})
+
+	context("failure cases", func() {
+		context("when BPL_HTTPD_MAX_REQUEST_WORKERS is invalid", func() {
+			it("returns an error", func() {
+				_, err := internal.SizeWorkers(map[string]string{"BPL_HTTPD_MAX_REQUEST_WORKERS": "0"}, cgroupRoot)
+				Expect(err).To(MatchError(`failed to parse BPL_HTTPD_MAX_REQUEST_WORKERS: "0" is not a positive integer or 'auto'`))
+			})
+		})
+
+		context("when the memory limit cannot be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("lots\n"), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := internal.SizeWorkers(nil, cgroupRoot)
+				Expect(err).To(MatchError(ContainSubstring("failed to read cgroup memory limit")))
+			})
+		})
+	})
+}
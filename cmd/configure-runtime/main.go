@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/paketo-buildpacks/httpd/cmd/configure-runtime/internal"
+)
+
+func main() {
+	err := internal.Run(os.Environ(), os.Geteuid(), "/sys/fs/cgroup", os.NewFile(3, "/dev/fd/3"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
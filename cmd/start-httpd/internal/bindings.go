@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/httpd"
+)
+
+// ConfigBindingArgs returns the httpd command line arguments that include the
+// *.conf entries of every httpd-config binding under SERVICE_BINDING_ROOT,
+// or CNB_BINDINGS when it is not set, in the order of the binding names. The
+// entries are included with IncludeOptional after the config file has been
+// read, so that they apply to any config and can override its directives.
+func ConfigBindingArgs(env map[string]string) ([]string, error) {
+	root := env["SERVICE_BINDING_ROOT"]
+	if root == "" {
+		root = env["CNB_BINDINGS"]
+	}
+
+	if root == "" {
+		return nil, nil
+	}
+
+	bindings, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bindings from '%s': %w", root, err)
+	}
+
+	var args []string
+	for _, binding := range bindings {
+		// Kubernetes projects the entries through hidden directories such as
+		// ..data, which are not bindings.
+		if strings.HasPrefix(binding.Name(), ".") {
+			continue
+		}
+
+		typ, err := os.ReadFile(filepath.Join(root, binding.Name(), "type"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read binding '%s': %w", binding.Name(), err)
+		}
+
+		if !strings.EqualFold(strings.TrimSpace(string(typ)), httpd.ConfigBindingType) {
+			continue
+		}
+
+		args = append(args, "-c", fmt.Sprintf("IncludeOptional %q", filepath.Join(root, binding.Name(), "*.conf")))
+	}
+
+	return args, nil
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CacheCleanInterval is the number of minutes between the runs of
+// htcacheclean, which keeps the disk cache under HTTPD_CACHE_MAX_SIZE.
+const CacheCleanInterval = 10
+
+// StartCacheCleaner starts htcacheclean as a daemon when the generated config
+// caches responses in HTTPD_CACHE_ROOT, as mod_cache_disk does not limit the
+// size of the cache on its own. htcacheclean is taken from the directory of
+// the httpd command, or from the PATH when the command is a bare name.
+func StartCacheCleaner(httpd string, environ []string, env map[string]string, stdout, stderr io.Writer) error {
+	root, size := env["HTTPD_CACHE_ROOT"], env["HTTPD_CACHE_MAX_SIZE"]
+	if root == "" || size == "" {
+		return nil
+	}
+
+	command := "htcacheclean"
+	if strings.ContainsRune(httpd, filepath.Separator) {
+		command = filepath.Join(filepath.Dir(httpd), command)
+	}
+
+	// The daemon detaches itself, so the command returns once it has started.
+	cmd := exec.Command(command, fmt.Sprintf("-d%d", CacheCleanInterval), "-n", "-t", fmt.Sprintf("-p%s", root), fmt.Sprintf("-l%s", size))
+	cmd.Env = environ
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to start htcacheclean: %w", err)
+	}
+
+	return nil
+}
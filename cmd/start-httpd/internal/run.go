@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultGracefulShutdownTimeout is the number of seconds that httpd waits
+	// for in-flight requests to complete once it has been asked to stop. It
+	// leaves httpd time to exit before the default 30 second termination grace
+	// period of Kubernetes ends.
+	DefaultGracefulShutdownTimeout = 25
+
+	// ForcedStopDelay is how long the wrapper waits past the graceful shutdown
+	// timeout before it stops httpd immediately.
+	ForcedStopDelay = 5 * time.Second
+)
+
+// ForwardedSignals are the signals that are passed on to httpd. SIGTERM is
+// translated into SIGWINCH, which asks httpd to stop gracefully, and SIGUSR1,
+// which asks httpd to reload its configuration gracefully, is only passed on
+// once the configuration passes a syntax check.
+var ForwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGWINCH}
+
+// Run starts the httpd command given in args and waits for it to exit,
+// returning its exit code. The GracefulShutdownTimeout directive is appended
+// to the command line from BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT so that it
+// applies to custom configuration files as well, followed by the fragments of
+// the httpd-config service bindings. A SIGTERM received on signals is turned
+// into a graceful stop, a SIGUSR1 into a graceful reload after a successful
+// syntax check, and every other signal is forwarded unchanged. The disk cache
+// of the generated config is kept under its size by htcacheclean.
+func Run(args, environ []string, signals <-chan os.Signal, stdout, stderr io.Writer) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("failed to start httpd: no command given")
+	}
+
+	env := map[string]string{}
+	for _, variable := range environ {
+		key, value, _ := strings.Cut(variable, "=")
+		env[key] = value
+	}
+
+	timeout, err := GracefulShutdownTimeout(env)
+	if err != nil {
+		return 0, err
+	}
+
+	bindingArgs, err := ConfigBindingArgs(env)
+	if err != nil {
+		return 0, err
+	}
+
+	err = StartCacheCleaner(args[0], environ, env, stdout, stderr)
+	if err != nil {
+		return 0, err
+	}
+
+	args = append(args[:len(args):len(args)], "-c", fmt.Sprintf("GracefulShutdownTimeout %d", timeout))
+	args = append(args, bindingArgs...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = environ
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start httpd: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var forcedStop <-chan time.Time
+	for {
+		select {
+		case signal := <-signals:
+			switch signal {
+			case syscall.SIGUSR1:
+				err := testConfig(args, environ, stderr)
+				if err != nil {
+					fmt.Fprintf(stderr, "Not reloading httpd: %s\n", err)
+					continue
+				}
+
+			case syscall.SIGTERM:
+				signal = syscall.SIGWINCH
+
+				// A timeout of 0 lets httpd wait for in-flight requests
+				// indefinitely.
+				if timeout > 0 && forcedStop == nil {
+					forcedStop = time.After(time.Duration(timeout)*time.Second + ForcedStopDelay)
+				}
+			}
+
+			// The process may already have exited, in which case Wait reports
+			// its status.
+			_ = cmd.Process.Signal(signal)
+
+		case <-forcedStop:
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if err != nil && !errors.As(err, &exitErr) {
+				return 0, err
+			}
+
+			status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+			if ok && status.Signaled() {
+				return 128 + int(status.Signal()), nil
+			}
+
+			return cmd.ProcessState.ExitCode(), nil
+		}
+	}
+}
+
+// testConfig runs the given httpd command with -t, which only checks the
+// syntax of the configuration files, and reports its output on stderr.
+func testConfig(args, environ []string, stderr io.Writer) error {
+	cmd := exec.Command(args[0], append(args[1:len(args):len(args)], "-t")...)
+	cmd.Env = environ
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("configuration test failed: %w", err)
+	}
+
+	return nil
+}
+
+// GracefulShutdownTimeout returns the number of seconds configured through
+// BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT, or the default when it is not set.
+func GracefulShutdownTimeout(env map[string]string) (int, error) {
+	value := env["BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT"]
+	if value == "" {
+		return DefaultGracefulShutdownTimeout, nil
+	}
+
+	timeout, err := strconv.Atoi(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("failed to parse BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT: %q is not a non-negative integer", value)
+	}
+
+	return timeout, nil
+}
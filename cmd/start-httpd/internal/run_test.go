@@ -0,0 +1,255 @@
+package internal_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd/cmd/start-httpd/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+// syncBuffer is written to by httpd and the configuration test while the
+// test reads from it.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func testRun(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect       = NewWithT(t).Expect
+		Eventually   = NewWithT(t).Eventually
+		Consistently = NewWithT(t).Consistently
+
+		tmpDir  string
+		httpd   string
+		signals chan os.Signal
+		buffer  *syncBuffer
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "start-httpd")
+		Expect(err).NotTo(HaveOccurred())
+
+		// The fake httpd records its arguments once it is ready to receive
+		// signals, and exits with a distinct code on a graceful stop. Its
+		// configuration test fails when a file named invalid exists.
+		httpd = filepath.Join(tmpDir, "httpd")
+		Expect(os.WriteFile(httpd, []byte(`#!/bin/sh
+dir="$(dirname "$0")"
+for arg in "$@"; do
+  if [ "$arg" = "-t" ]; then
+    if [ -e "$dir/invalid" ]; then echo "Syntax error" >&2; exit 1; fi
+    echo "Syntax OK" >&2
+    exit 0
+  fi
+done
+trap 'echo graceful-stop; exit 3' WINCH
+trap 'echo graceful-restart' USR1
+trap 'echo stop; exit 4' INT
+echo "$@" > "$dir/args"
+while true; do sleep 0.05; done
+`), 0755)).To(Succeed())
+
+		signals = make(chan os.Signal, 1)
+		buffer = &syncBuffer{}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	start := func(environ []string) chan int {
+		codes := make(chan int, 1)
+		go func() {
+			defer close(codes)
+			code, err := internal.Run([]string{httpd, "-f", "httpd.conf", "-DFOREGROUND"}, environ, signals, buffer, buffer)
+			Expect(err).NotTo(HaveOccurred())
+			codes <- code
+		}()
+
+		Eventually(filepath.Join(tmpDir, "args")).Should(BeARegularFile())
+		return codes
+	}
+
+	it("turns SIGTERM into a graceful stop and returns the exit code", func() {
+		codes := start(nil)
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "args"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("-f httpd.conf -DFOREGROUND -c GracefulShutdownTimeout 25\n"))
+
+		signals <- syscall.SIGTERM
+		Eventually(codes).Should(Receive(Equal(3)))
+		Expect(buffer.String()).To(Equal("graceful-stop\n"))
+	})
+
+	it("forwards other signals unchanged", func() {
+		codes := start(nil)
+
+		signals <- syscall.SIGINT
+		Eventually(codes).Should(Receive(Equal(4)))
+		Expect(buffer.String()).To(Equal("stop\n"))
+	})
+
+	it("reloads the configuration gracefully on SIGUSR1 once it passes a syntax check", func() {
+		codes := start(nil)
+
+		signals <- syscall.SIGUSR1
+		Eventually(buffer.String).Should(Equal("Syntax OK\ngraceful-restart\n"))
+
+		signals <- syscall.SIGTERM
+		Eventually(codes).Should(Receive(Equal(3)))
+	})
+
+	context("when the configuration does not pass the syntax check", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(tmpDir, "invalid"), nil, 0644)).To(Succeed())
+		})
+
+		it("keeps running with the current configuration", func() {
+			codes := start(nil)
+
+			signals <- syscall.SIGUSR1
+			Eventually(buffer.String).Should(ContainSubstring("Not reloading httpd: configuration test failed: exit status 1"))
+			Expect(buffer.String()).To(HavePrefix("Syntax error\n"))
+			Consistently(codes).ShouldNot(Receive())
+
+			signals <- syscall.SIGTERM
+			Eventually(codes).Should(Receive(Equal(3)))
+			Expect(buffer.String()).NotTo(ContainSubstring("graceful-restart"))
+		})
+	})
+
+	context("when BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT is set", func() {
+		it("sets the graceful shutdown timeout", func() {
+			codes := start([]string{"BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT=60"})
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "args"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("-f httpd.conf -DFOREGROUND -c GracefulShutdownTimeout 60\n"))
+
+			signals <- syscall.SIGTERM
+			Eventually(codes).Should(Receive(Equal(3)))
+		})
+	})
+
+	context("when httpd-config service bindings are present", func() {
+		it.Before(func() {
+			for name, typ := range map[string]string{"org-policy": "httpd-config", "headers": "HTTPD-CONFIG\n", "database": "postgres"} {
+				Expect(os.MkdirAll(filepath.Join(tmpDir, "bindings", name), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(tmpDir, "bindings", name, "type"), []byte(typ), 0644)).To(Succeed())
+			}
+			Expect(os.MkdirAll(filepath.Join(tmpDir, "bindings", "..data"), os.ModePerm)).To(Succeed())
+		})
+
+		it("includes their config fragments", func() {
+			codes := start([]string{"SERVICE_BINDING_ROOT=" + filepath.Join(tmpDir, "bindings")})
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "args"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(fmt.Sprintf("-f httpd.conf -DFOREGROUND -c GracefulShutdownTimeout 25 -c IncludeOptional %q -c IncludeOptional %q\n",
+				filepath.Join(tmpDir, "bindings", "headers", "*.conf"),
+				filepath.Join(tmpDir, "bindings", "org-policy", "*.conf"),
+			)))
+
+			signals <- syscall.SIGTERM
+			Eventually(codes).Should(Receive(Equal(3)))
+		})
+	})
+
+	context("when the generated config caches responses", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(tmpDir, "htcacheclean"), []byte("#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/htcacheclean-args\"\n"), 0755)).To(Succeed())
+		})
+
+		it("starts htcacheclean to keep the cache under its size", func() {
+			codes := start([]string{"HTTPD_CACHE_ROOT=/tmp/cache", "HTTPD_CACHE_MAX_SIZE=100M"})
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "htcacheclean-args"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("-d10 -n -t -p/tmp/cache -l100M\n"))
+
+			signals <- syscall.SIGTERM
+			Eventually(codes).Should(Receive(Equal(3)))
+		})
+
+		context("when htcacheclean fails", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(tmpDir, "htcacheclean"), []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run([]string{httpd}, []string{"HTTPD_CACHE_ROOT=/tmp/cache", "HTTPD_CACHE_MAX_SIZE=100M"}, signals, buffer, buffer)
+				Expect(err).To(MatchError(ContainSubstring("failed to start htcacheclean")))
+			})
+		})
+	})
+
+	context("when httpd exits on its own", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(httpd, []byte("#!/bin/sh\nexit 7\n"), 0755)).To(Succeed())
+		})
+
+		it("returns the exit code", func() {
+			code, err := internal.Run([]string{httpd}, nil, signals, buffer, buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal(7))
+		})
+	})
+
+	context("when httpd is killed by a signal", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(httpd, []byte("#!/bin/sh\nkill -KILL $$\n"), 0755)).To(Succeed())
+		})
+
+		it("returns the conventional exit code for the signal", func() {
+			code, err := internal.Run([]string{httpd}, nil, signals, buffer, buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal(137))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT is invalid", func() {
+			it("returns an error", func() {
+				_, err := internal.Run([]string{httpd}, []string{"BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT=-1"}, signals, buffer, buffer)
+				Expect(err).To(MatchError(`failed to parse BPL_HTTPD_GRACEFUL_SHUTDOWN_TIMEOUT: "-1" is not a non-negative integer`))
+			})
+		})
+
+		context("when no command is given", func() {
+			it("returns an error", func() {
+				_, err := internal.Run(nil, nil, signals, buffer, buffer)
+				Expect(err).To(MatchError("failed to start httpd: no command given"))
+			})
+		})
+
+		context("when httpd cannot be started", func() {
+			it("returns an error", func() {
+				_, err := internal.Run([]string{filepath.Join(tmpDir, "missing")}, nil, signals, buffer, buffer)
+				Expect(err).To(MatchError(ContainSubstring("failed to start httpd")))
+			})
+		})
+	})
+}
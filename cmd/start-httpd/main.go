@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/paketo-buildpacks/httpd/cmd/start-httpd/internal"
+)
+
+func main() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, internal.ForwardedSignals...)
+
+	code, err := internal.Run(os.Args[1:], os.Environ(), signals, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
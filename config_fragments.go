@@ -0,0 +1,96 @@
+package httpd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+)
+
+// DefaultWebServerConfDir is the directory, relative to the app, that config
+// fragments are read from when BP_WEB_SERVER_CONF_DIR is not set.
+const DefaultWebServerConfDir = "httpd.conf.d"
+
+// DropInConfDir is the directory of the httpd layer in which later buildpacks
+// place config fragments. It is exported to them and to the app as
+// HTTPD_CONF_D.
+const DropInConfDir = "conf.d"
+
+// configFragments are the hook points of the generated config that include
+// fragments from the app. The *.conf files at the top of the directory are
+// included in the server config, the ones in directory/ inside the
+// <Directory> block of every location and every vhosts/<name>.conf in a
+// virtual host named after the file.
+type configFragments struct {
+	Global       string
+	Directory    string
+	VirtualHosts []string
+}
+
+// findConfigFragments looks up the hook points that the given fragments
+// directory provides. A directory that was not configured explicitly does not
+// need to exist.
+func findConfigFragments(workingDir, dir string, configured bool) (configFragments, error) {
+	var fragments configFragments
+
+	root := expandWebServerRoot(dir)
+	path := resolveWebServerRoot(workingDir, root)
+
+	exists, err := fs.Exists(path)
+	if err != nil {
+		return configFragments{}, err
+	}
+
+	if !exists {
+		if configured {
+			return configFragments{}, fmt.Errorf("failed: config fragments directory '%s' does not exist", root)
+		}
+		return configFragments{}, nil
+	}
+
+	fragments.Global = fmt.Sprintf("%s/*.conf", root)
+
+	exists, err = fs.Exists(filepath.Join(path, "directory"))
+	if err != nil {
+		return configFragments{}, err
+	}
+
+	if exists {
+		fragments.Directory = fmt.Sprintf("%s/directory/*.conf", root)
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "vhosts", "*.conf"))
+	if err != nil {
+		return configFragments{}, err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return configFragments{}, err
+		}
+
+		if info.IsDir() {
+			continue
+		}
+
+		fragments.VirtualHosts = append(fragments.VirtualHosts, fmt.Sprintf("%s/vhosts/%s", root, filepath.Base(file)))
+	}
+
+	return fragments, nil
+}
+
+// plannedConfigFragments returns the hook points of a fragments directory that
+// the build plan requires, which a later buildpack may only create after httpd
+// is built. Its fragments are included when they exist at launch, while its
+// virtual hosts can only be found in a directory that exists at build time.
+func plannedConfigFragments(dir string) configFragments {
+	root := expandWebServerRoot(dir)
+	return configFragments{
+		Global:    fmt.Sprintf("%s/*.conf", root),
+		Directory: fmt.Sprintf("%s/directory/*.conf", root),
+	}
+}
@@ -0,0 +1,36 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/paketo-buildpacks/httpd"
+)
+
+type BuildModule struct {
+	BuildCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Source     httpd.ModuleSource
+			ServerRoot string
+			LayerPath  string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(httpd.ModuleSource, string, string) error
+	}
+}
+
+func (f *BuildModule) Build(param1 httpd.ModuleSource, param2 string, param3 string) error {
+	f.BuildCall.mutex.Lock()
+	defer f.BuildCall.mutex.Unlock()
+	f.BuildCall.CallCount++
+	f.BuildCall.Receives.Source = param1
+	f.BuildCall.Receives.ServerRoot = param2
+	f.BuildCall.Receives.LayerPath = param3
+	if f.BuildCall.Stub != nil {
+		return f.BuildCall.Stub(param1, param2, param3)
+	}
+	return f.BuildCall.Returns.Error
+}
@@ -0,0 +1,36 @@
+package fakes
+
+import (
+	"sync"
+)
+
+type CheckConfig struct {
+	CheckCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			ConfigPath   string
+			AppRoot      string
+			ServerRoot   string
+			PlatformPath string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, string, string, string) error
+	}
+}
+
+func (f *CheckConfig) Check(param1 string, param2 string, param3 string, param4 string) error {
+	f.CheckCall.mutex.Lock()
+	defer f.CheckCall.mutex.Unlock()
+	f.CheckCall.CallCount++
+	f.CheckCall.Receives.ConfigPath = param1
+	f.CheckCall.Receives.AppRoot = param2
+	f.CheckCall.Receives.ServerRoot = param3
+	f.CheckCall.Receives.PlatformPath = param4
+	if f.CheckCall.Stub != nil {
+		return f.CheckCall.Stub(param1, param2, param3, param4)
+	}
+	return f.CheckCall.Returns.Error
+}
@@ -13,24 +13,26 @@ type GenerateConfig struct {
 		Receives  struct {
 			WorkingDir       string
 			PlatformPath     string
+			ServerRoot       string
 			BuildEnvironment httpd.BuildEnvironment
 		}
 		Returns struct {
 			Error error
 		}
-		Stub func(string, string, httpd.BuildEnvironment) error
+		Stub func(string, string, string, httpd.BuildEnvironment) error
 	}
 }
 
-func (f *GenerateConfig) Generate(param1 string, param2 string, param3 httpd.BuildEnvironment) error {
+func (f *GenerateConfig) Generate(param1 string, param2 string, param3 string, param4 httpd.BuildEnvironment) error {
 	f.GenerateCall.mutex.Lock()
 	defer f.GenerateCall.mutex.Unlock()
 	f.GenerateCall.CallCount++
 	f.GenerateCall.Receives.WorkingDir = param1
 	f.GenerateCall.Receives.PlatformPath = param2
-	f.GenerateCall.Receives.BuildEnvironment = param3
+	f.GenerateCall.Receives.ServerRoot = param3
+	f.GenerateCall.Receives.BuildEnvironment = param4
 	if f.GenerateCall.Stub != nil {
-		return f.GenerateCall.Stub(param1, param2, param3)
+		return f.GenerateCall.Stub(param1, param2, param3, param4)
 	}
 	return f.GenerateCall.Returns.Error
 }
@@ -0,0 +1,61 @@
+package httpd
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFastCGIPattern selects the requests that are passed to the FastCGI
+// upstream when BP_WEB_SERVER_FASTCGI_PATTERN is not set.
+const DefaultFastCGIPattern = "*.php"
+
+// fastCGIUpstreamURL turns the address of a FastCGI upstream into the URL that
+// mod_proxy_fcgi connects to. The address is either a "<host>:<port>" TCP
+// address, optionally with a tcp:// or fcgi:// scheme, or the absolute path of
+// a unix socket, optionally with a unix: prefix.
+func fastCGIUpstreamURL(upstream string) (string, error) {
+	upstream = strings.TrimSpace(upstream)
+
+	if path, ok := strings.CutPrefix(upstream, "unix:"); ok || strings.HasPrefix(upstream, "/") {
+		if !ok {
+			path = upstream
+		}
+
+		if filepath.IsAbs(path) {
+			return fmt.Sprintf("unix:%s|fcgi://localhost", filepath.Clean(path)), nil
+		}
+	} else {
+		address := strings.TrimSuffix(upstream, "/")
+		for _, scheme := range []string{"fcgi://", "tcp://"} {
+			address = strings.TrimPrefix(address, scheme)
+		}
+
+		host, port, err := net.SplitHostPort(address)
+		if err == nil && host != "" && port != "" {
+			return fmt.Sprintf("fcgi://%s", address), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed: the FastCGI upstream must be a '<host>:<port>' address or the absolute path of a unix socket, got '%s'", upstream)
+}
+
+// fastCGIPrefix returns the URL path prefix of a FastCGI pattern that starts
+// with a slash. Any other pattern matches the names of files.
+func fastCGIPrefix(pattern string) (string, bool) {
+	if !strings.HasPrefix(pattern, "/") {
+		return "", false
+	}
+	return normalizeURLPath(pattern), true
+}
+
+// fastCGIIndex returns the index file of a pattern that matches the file
+// extension of the scripts of the upstream, such as index.php for *.php.
+func fastCGIIndex(pattern string) string {
+	extension, ok := strings.CutPrefix(pattern, "*.")
+	if !ok || strings.ContainsAny(extension, "*?[/") {
+		return ""
+	}
+	return fmt.Sprintf("index.%s", extension)
+}
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"text/template"
+	"strings"
 
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
@@ -20,6 +21,45 @@ type GenerateHTTPDConfig struct {
 	logger          scribe.Emitter
 }
 
+// webServerLocation maps a URL path prefix onto a directory that is served
+// from it. An empty Path serves the directory as the DocumentRoot.
+type webServerLocation struct {
+	Path           string
+	Root           string
+	PushState      bool
+	BasicAuth      bool
+	ErrorDocuments []string
+}
+
+type httpdConfData struct {
+	BuildEnvironment
+	Locations      []webServerLocation
+	Fragments      configFragments
+	ExtraModules   []string
+	DirectoryIndex []string
+	Balancer       proxyBalancer
+	CachePaths     []string
+	LogRedaction   logRedaction
+}
+
+func (d httpdConfData) PushStateEnabled() bool {
+	for _, location := range d.Locations {
+		if location.PushState {
+			return true
+		}
+	}
+	return false
+}
+
+func (d httpdConfData) BasicAuthEnabled() bool {
+	for _, location := range d.Locations {
+		if location.BasicAuth {
+			return true
+		}
+	}
+	return false
+}
+
 func NewGenerateHTTPDConfig(bindingResolver BindingResolver, logger scribe.Emitter) GenerateHTTPDConfig {
 	return GenerateHTTPDConfig{
 		bindingResolver: bindingResolver,
@@ -27,28 +67,252 @@ func NewGenerateHTTPDConfig(bindingResolver BindingResolver, logger scribe.Emitt
 	}
 }
 
-func (g GenerateHTTPDConfig) Generate(workingDir, platformPath string, buildEnvironment BuildEnvironment) error {
+func (g GenerateHTTPDConfig) Generate(workingDir, platformPath, serverRoot string, buildEnvironment BuildEnvironment) error {
 	g.logger.Process("Generating httpd.conf")
 
-	t, err := template.New("httpd.conf").Parse(httpdConf)
+	buildEnvironment.MPM = buildEnvironment.selectedMPM()
+	switch buildEnvironment.MPM {
+	case "event", "worker", "prefork":
+	default:
+		return fmt.Errorf("failed: BP_HTTPD_MPM must be one of 'event', 'worker' or 'prefork', got '%s'", buildEnvironment.MPM)
+	}
+
+	exists, err := fs.Exists(filepath.Join(serverRoot, "modules", fmt.Sprintf("mod_mpm_%s.so", buildEnvironment.MPM)))
 	if err != nil {
 		return err
 	}
 
-	confFile, err := os.Create(filepath.Join(workingDir, "httpd.conf"))
+	if !exists {
+		return fmt.Errorf("failed: the installed Apache HTTP Server does not provide the '%s' MPM", buildEnvironment.MPM)
+	}
+
+	if buildEnvironment.MPM != DefaultMPM {
+		g.logger.Subprocess("Adds configuration that uses the '%s' MPM", buildEnvironment.MPM)
+	}
+
+	// The modules that were built from the app are always loaded, so naming
+	// them in BP_HTTPD_MODULES is not an error.
+	built := map[string]bool{}
+	for _, file := range buildEnvironment.BuiltModules {
+		built[strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "mod_"), ".so")] = true
+	}
+
+	var modules []string
+	for _, module := range parseModuleNames(buildEnvironment.Modules) {
+		if !built[module] {
+			modules = append(modules, module)
+		}
+	}
+
+	err = validateModules(serverRoot, modules)
 	if err != nil {
 		return err
 	}
 
-	if buildEnvironment.WebServerRoot == "" {
-		buildEnvironment.WebServerRoot = "${APP_ROOT}/public"
+	if len(modules) > 0 {
+		g.logger.Subprocess("Adds configuration that loads the modules '%s'", strings.Join(modules, "', '"))
+	}
+
+	for _, file := range buildEnvironment.BuiltModules {
+		g.logger.Subprocess("Adds configuration that loads the module built from the app at '%s'", file)
+	}
+
+	basePath := normalizeURLPath(buildEnvironment.WebServerBasePath)
+	if basePath != "" {
+		g.logger.Subprocess("Adds configuration to serve web server root under base path '%s'", basePath)
+	}
+	buildEnvironment.WebServerBasePath = basePath
+
+	// The web server roots need an index that the generated config serves,
+	// unless every request is passed to the FastCGI upstream.
+	directoryIndex := []string{"index.html"}
+	indexes := directoryIndex
+
+	// The requests under these URL path prefixes are passed to an upstream,
+	// where the scripts of a FastCGI file pattern may be under any path. Like
+	// the paths of the locations, they are relative to the base path.
+	var proxied []string
+	if buildEnvironment.FastCGIUpstream != "" {
+		pattern := buildEnvironment.FastCGIPattern
+		if pattern == "" {
+			pattern = DefaultFastCGIPattern
+		}
+
+		if prefix, ok := fastCGIPrefix(pattern); ok {
+			if prefix == "" {
+				indexes = nil
+			}
+			proxied = append(proxied, prefix)
+
+			pattern = fmt.Sprintf("%s%s/", basePath, prefix)
+			g.logger.Subprocess("Adds configuration that passes the requests under '%s' to the FastCGI upstream '%s'", pattern, buildEnvironment.FastCGIUpstream)
+		} else {
+			if strings.Contains(pattern, "/") {
+				return fmt.Errorf("failed: BP_WEB_SERVER_FASTCGI_PATTERN must be a file name pattern such as '*.php' or a URL path prefix such as '/api', got '%s'", pattern)
+			}
+
+			g.logger.Subprocess("Adds configuration that passes the requests for '%s' files to the FastCGI upstream '%s'", pattern, buildEnvironment.FastCGIUpstream)
+			if index := fastCGIIndex(pattern); index != "" {
+				directoryIndex = append([]string{index}, directoryIndex...)
+				indexes = directoryIndex
+			}
+			proxied = append(proxied, "")
+		}
+
+		buildEnvironment.FastCGIPattern = pattern
+	}
+
+	var balancer proxyBalancer
+	if buildEnvironment.ProxyPath != "" {
+		bindings, err := g.bindingResolver.Resolve(UpstreamBindingType, "", platformPath)
+		if err != nil {
+			return err
+		}
+
+		if len(bindings) > 1 {
+			return fmt.Errorf("failed: binding resolver found more than one binding of type '%s'", UpstreamBindingType)
+		}
+
+		var bindingUpstreams string
+		if len(bindings) == 1 {
+			entry, ok := bindings[0].Entries["urls"]
+			if !ok {
+				return fmt.Errorf("failed: binding of type '%s' does not contain required entry 'urls'", UpstreamBindingType)
+			}
+
+			bindingUpstreams, err = entry.ReadString()
+			if err != nil {
+				return err
+			}
+
+			if buildEnvironment.ProxyUpstreams != "" {
+				g.logger.Subprocess("BP_WEB_SERVER_PROXY_UPSTREAMS takes precedence over the upstreams of binding '%s'", bindings[0].Name)
+			}
+		}
+
+		balancer, err = parseProxyBalancer(buildEnvironment, bindingUpstreams)
+		if err != nil {
+			return err
+		}
+
+		proxied = append(proxied, balancer.Path)
+		balancer.Path = basePath + balancer.Path
+
+		g.logger.Subprocess("Adds configuration that passes the requests under '%s/' to the upstreams '%s' with the '%s' method", balancer.Path, strings.Join(balancer.Members, "', '"), balancer.Method)
+	} else if buildEnvironment.ProxyUpstreams != "" {
+		return fmt.Errorf("failed: BP_WEB_SERVER_PROXY_UPSTREAMS is set without BP_WEB_SERVER_PROXY_PATH, which selects the requests that are passed to them")
+	}
+
+	cachePaths, err := parseCachePaths(buildEnvironment.CachePaths, proxied)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range cachePaths {
+		cachePaths[i] = basePath + path
+	}
+
+	if len(cachePaths) > 0 {
+		buildEnvironment.CacheMaxSize, err = buildEnvironment.cacheMaxSize()
+		if err != nil {
+			return err
+		}
+
+		var prefixes []string
+		for _, path := range cachePaths {
+			prefixes = append(prefixes, path+"/")
+		}
+		g.logger.Subprocess("Adds configuration that caches the responses under '%s' on disk up to a size of %s", strings.Join(prefixes, "', '"), buildEnvironment.CacheMaxSize)
+	}
+
+	redaction, err := parseLogRedaction(buildEnvironment.LogRedactQueryParams, buildEnvironment.LogRedactHeaders)
+	if err != nil {
+		return err
+	}
+
+	if len(redaction.QueryParams) > 0 {
+		g.logger.Subprocess("Adds configuration that masks the query parameters '%s' in the access log", strings.Join(redaction.QueryParams, "', '"))
+	}
+
+	if len(redaction.Headers) > 0 {
+		g.logger.Subprocess("Adds configuration that masks the headers '%s' in the access log", strings.Join(redaction.Headers, "', '"))
+	}
+
+	var locations []webServerLocation
+	if buildEnvironment.WebServerLocations != "" {
+		if buildEnvironment.WebServerRoot != "" {
+			return fmt.Errorf("failed: BP_WEB_SERVER_ROOT and BP_WEB_SERVER_LOCATIONS cannot be set at the same time")
+		}
+
+		locations, err = parseWebServerLocations(buildEnvironment.WebServerLocations)
+		if err != nil {
+			return err
+		}
+
+		for i, location := range locations {
+			location.Path = normalizeURLPath(basePath + location.Path)
+			location.Root = expandWebServerRoot(location.Root)
+			location.PushState = location.PushState || buildEnvironment.WebServerPushStateEnabled
+			g.logger.Subprocess("Adds configuration to serve '%s' at '%s/'", location.Root, location.Path)
+			locations[i] = location
+		}
 	} else {
-		webServerRoot := buildEnvironment.WebServerRoot
-		if !filepath.IsAbs(webServerRoot) {
-			webServerRoot = fmt.Sprintf("${APP_ROOT}/%s", webServerRoot)
+		if buildEnvironment.WebServerRoot == "" {
+			webServerRoot, err := detectWebServerRoot(workingDir, indexes)
+			if err != nil {
+				return err
+			}
+
+			buildEnvironment.WebServerRoot = expandWebServerRoot(webServerRoot)
+			g.logger.Subprocess("Detected web server root '%s'", buildEnvironment.WebServerRoot)
+		} else {
+			webServerRoot := expandWebServerRoot(buildEnvironment.WebServerRoot)
+			g.logger.Subprocess("Adds configuration to set web server root to '%s'", webServerRoot)
+			buildEnvironment.WebServerRoot = webServerRoot
+		}
+
+		locations = []webServerLocation{
+			{
+				Path:      basePath,
+				Root:      buildEnvironment.WebServerRoot,
+				PushState: buildEnvironment.WebServerPushStateEnabled,
+			},
 		}
-		g.logger.Subprocess("Adds configuration to set web server root to '%s'", webServerRoot)
-		buildEnvironment.WebServerRoot = webServerRoot
+	}
+
+	for i, location := range locations {
+		err = validateWebServerRoot(workingDir, location.Root, indexes)
+		if err != nil {
+			return err
+		}
+
+		locations[i].ErrorDocuments, err = findErrorDocuments(workingDir, location.Root)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range locations[i].ErrorDocuments {
+			g.logger.Subprocess("Adds configuration that serves '%s/%s.html' for the %s responses under '%s/'", location.Root, status, status, location.Path)
+		}
+
+		issues, err := checkWebServerRootPermissions(resolveWebServerRoot(workingDir, location.Root), buildEnvironment.WebServerFixPermissions)
+		if err != nil {
+			return err
+		}
+
+		if len(issues) > 0 {
+			g.logger.Subprocess("WARNING: The following paths in '%s' cannot be served by httpd:", location.Root)
+			for _, issue := range issues {
+				g.logger.Action(issue)
+			}
+			if !buildEnvironment.WebServerFixPermissions {
+				g.logger.Subprocess("Set $BP_WEB_SERVER_FIX_PERMISSIONS to true to grant the missing permissions during the build.")
+			}
+		}
+	}
+
+	if buildEnvironment.WebServerFixPermissions {
+		g.logger.Subprocess("Adds read permissions for all users to the web server root")
 	}
 
 	if buildEnvironment.WebServerPushStateEnabled {
@@ -76,18 +340,123 @@ func (g GenerateHTTPDConfig) Generate(workingDir, platformPath string, buildEnvi
 		g.logger.Subprocess("Adds configuration that configured basic authentication from service binding")
 
 		buildEnvironment.BasicAuthFile = filepath.Join(bindings[0].Path, ".htpasswd")
+
+		// Without explicit locations the binding protects the whole site.
+		if buildEnvironment.WebServerLocations == "" {
+			locations[0].BasicAuth = true
+		}
 	}
 
-	g.logger.Break()
+	for _, location := range locations {
+		if location.BasicAuth && buildEnvironment.BasicAuthFile == "" {
+			return fmt.Errorf("failed: location '%s/' requires basic authentication but no binding of type 'htpasswd' was found", location.Path)
+		}
+	}
 
-	err = t.Execute(confFile, buildEnvironment)
-	if err != nil {
-		return err
+	confDir := buildEnvironment.WebServerConfDir
+	if confDir == "" {
+		confDir = buildEnvironment.PlanConfDir
+	}
+	if confDir == "" {
+		confDir = DefaultWebServerConfDir
 	}
 
-	err = confFile.Close()
+	fragments, err := findConfigFragments(workingDir, confDir, buildEnvironment.WebServerConfDir != "")
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if fragments.Global == "" && buildEnvironment.WebServerConfDir == "" && buildEnvironment.PlanConfDir != "" {
+		fragments = plannedConfigFragments(confDir)
+	}
+
+	if fragments.Global != "" {
+		g.logger.Subprocess("Adds configuration that includes the fragments in '%s'", expandWebServerRoot(confDir))
+	}
+
+	for _, file := range fragments.VirtualHosts {
+		g.logger.Action("Virtual host from '%s'", file)
+	}
+
+	g.logger.Break()
+
+	data := httpdConfData{
+		BuildEnvironment: buildEnvironment,
+		Locations:        locations,
+		Fragments:        fragments,
+		ExtraModules:     modules,
+		DirectoryIndex:   directoryIndex,
+		Balancer:         balancer,
+		CachePaths:       cachePaths,
+		LogRedaction:     redaction,
+	}
+
+	return os.WriteFile(filepath.Join(workingDir, "httpd.conf"), []byte(renderHTTPDConf(configFeatures(data), locations)), 0644)
+}
+
+// parseWebServerLocations parses a comma separated list of location mappings
+// of the form "<url-path>=<directory>[:<option>...]", where the supported
+// options are "push-state" and "basic-auth".
+func parseWebServerLocations(value string) ([]webServerLocation, error) {
+	var locations []webServerLocation
+	seen := map[string]bool{}
+
+	for _, mapping := range strings.Split(value, ",") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+
+		path, target, ok := strings.Cut(mapping, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("failed to parse BP_WEB_SERVER_LOCATIONS: invalid mapping %q: expected '<url-path>=<directory>'", mapping)
+		}
+
+		fields := strings.Split(target, ":")
+		if fields[0] == "" {
+			return nil, fmt.Errorf("failed to parse BP_WEB_SERVER_LOCATIONS: mapping %q does not specify a directory", mapping)
+		}
+
+		location := webServerLocation{
+			Path: normalizeURLPath(path),
+			Root: fields[0],
+		}
+
+		for _, option := range fields[1:] {
+			switch option {
+			case "push-state":
+				location.PushState = true
+			case "basic-auth":
+				location.BasicAuth = true
+			default:
+				return nil, fmt.Errorf("failed to parse BP_WEB_SERVER_LOCATIONS: unknown option %q in mapping %q", option, mapping)
+			}
+		}
+
+		if seen[location.Path] {
+			return nil, fmt.Errorf("failed to parse BP_WEB_SERVER_LOCATIONS: path '%s/' is mapped more than once", location.Path)
+		}
+		seen[location.Path] = true
+
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+func expandWebServerRoot(root string) string {
+	if !filepath.IsAbs(root) {
+		return fmt.Sprintf("${APP_ROOT}/%s", root)
+	}
+	return root
+}
+
+// normalizeURLPath returns the given path with a single leading slash and no
+// trailing slash. The root path is returned as an empty string.
+func normalizeURLPath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return fmt.Sprintf("/%s", path)
 }
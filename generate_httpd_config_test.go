@@ -3,8 +3,11 @@ package httpd_test
 import (
 	"bytes"
 	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/paketo-buildpacks/httpd"
@@ -16,6 +19,25 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/httpd_conf")
+
+// expectGolden compares a generated config with the golden file of the given
+// name, or rewrites the golden file when the tests run with -update.
+func expectGolden(t *testing.T, name, actual string) {
+	t.Helper()
+	Expect := NewWithT(t).Expect
+
+	path := filepath.Join("testdata", "httpd_conf", name)
+	if *updateGolden {
+		Expect(os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(actual), 0644)).To(Succeed())
+	}
+
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(actual).To(Equal(string(expected)), fmt.Sprintf("%s does not match, run the tests with -update to rewrite it", path))
+}
+
 func testGenerateHTTPDConfig(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
@@ -38,19 +60,32 @@ func testGenerateHTTPDConfig(t *testing.T, context spec.G, it spec.S) {
 	context("Generate", func() {
 		var (
 			workingDir string
+			serverRoot string
 		)
 		it.Before(func() {
 			var err error
 			workingDir, err = os.MkdirTemp("", "working-dir")
 			Expect(err).NotTo(HaveOccurred())
+
+			serverRoot, err = os.MkdirTemp("", "server-root")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(serverRoot, "modules"), os.ModePerm)).To(Succeed())
+			for _, mpm := range []string{"event", "worker", "prefork"} {
+				Expect(os.WriteFile(filepath.Join(serverRoot, "modules", fmt.Sprintf("mod_mpm_%s.so", mpm)), nil, 0644)).To(Succeed())
+			}
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, "public"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "index.html"), nil, 0644)).To(Succeed())
 		})
 
 		it.After(func() {
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
+			Expect(os.RemoveAll(serverRoot)).To(Succeed())
 		})
 
 		it("create a default httpd config", func() {
-			err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+			err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
@@ -58,56 +93,56 @@ func testGenerateHTTPDConfig(t *testing.T, context spec.G, it spec.S) {
 			Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("platform"))
 
 			Expect(buffer.String()).To(ContainSubstring("Generating httpd.conf"))
+			Expect(buffer.String()).To(ContainSubstring("Detected web server root '${APP_ROOT}/public'"))
 
 			contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
-
-ServerName "0.0.0.0"
-
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-
-TypesConfig conf/mime.types
-
-PidFile /tmp/httpd.pid
-
-User nobody
+			expectGolden(t, "default.conf", string(contents))
+		})
 
-Listen "${PORT}"
+		it("gives every request an ID that is passed on, returned and logged", func() {
+			err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
+			Expect(err).NotTo(HaveOccurred())
 
-DocumentRoot "${APP_ROOT}/public"
+			contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+			Expect(err).NotTo(HaveOccurred())
 
-DirectoryIndex index.html
+			Expect(string(contents)).To(ContainSubstring("LoadModule unique_id_module modules/mod_unique_id.so"))
+			Expect(string(contents)).To(ContainSubstring(`RequestHeader setifempty X-Request-ID "%{UNIQUE_ID}e"`))
+			Expect(string(contents)).To(ContainSubstring(`Header always set X-Request-ID "expr=%{req:X-Request-ID}" "expr=-n %{req:X-Request-ID}"`))
+			Expect(string(contents)).To(ContainSubstring(`[request\ %{X-Request-ID}i]`))
+			Expect(string(contents)).To(ContainSubstring(`\"%{X-Request-ID}i\" \"%{traceparent}i\"" access`))
+		})
 
-ErrorLog /proc/self/fd/2
+		context("when BP_WEB_SERVER_ROOT is not set and there is no public directory", func() {
+			it.Before(func() {
+				Expect(os.Rename(filepath.Join(workingDir, "public"), filepath.Join(workingDir, "dist"))).To(Succeed())
+			})
 
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
+			it("detects the web server root from common build output directories", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
+				Expect(err).NotTo(HaveOccurred())
 
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
+				Expect(buffer.String()).To(ContainSubstring("Detected web server root '${APP_ROOT}/dist'"))
 
-<Directory "${APP_ROOT}/public">
-  Require all granted
-</Directory>
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
 
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+				Expect(string(contents)).To(ContainSubstring(`DocumentRoot "${APP_ROOT}/dist"`))
+				Expect(string(contents)).To(ContainSubstring(`<Directory "${APP_ROOT}/dist">`))
+			})
 		})
 
 		context("when BP_WEB_SERVER_ROOT is set", func() {
 			context("when the path given is no absolute", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "htdocs"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "htdocs", "index.html"), nil, 0644)).To(Succeed())
+				})
+
 				it("creates a config with the adjusted DocumentRoot and Directory path", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{WebServerRoot: "htdocs"})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerRoot: "htdocs"})
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
@@ -119,110 +154,84 @@ CustomLog /proc/self/fd/1 common
 					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 					Expect(err).NotTo(HaveOccurred())
 
-					Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
-
-ServerName "0.0.0.0"
-
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-
-TypesConfig conf/mime.types
-
-PidFile /tmp/httpd.pid
-
-User nobody
-
-Listen "${PORT}"
-
-DocumentRoot "${APP_ROOT}/htdocs"
-
-DirectoryIndex index.html
-
-ErrorLog /proc/self/fd/2
-
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
-
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
-
-<Directory "${APP_ROOT}/htdocs">
-  Require all granted
-</Directory>
-
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+					expectGolden(t, "web_server_root.conf", string(contents))
 				})
 			})
 
 			context("when the path given is absolute", func() {
+				var absolutePath string
+
+				it.Before(func() {
+					absolutePath = filepath.Join(workingDir, "absolute", "path")
+					Expect(os.MkdirAll(absolutePath, os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(absolutePath, "index.html"), nil, 0644)).To(Succeed())
+				})
+
 				it("creates a config with the adjusted DocumentRoot and Directory path", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{WebServerRoot: "/absolute/path"})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerRoot: absolutePath})
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
 					Expect(bindingResolver.ResolveCall.Receives.Provider).To(Equal(""))
 					Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("platform"))
 
-					Expect(buffer.String()).To(ContainSubstring("Adds configuration to set web server root to '/absolute/path'"))
+					Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Adds configuration to set web server root to '%s'", absolutePath)))
 
 					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 					Expect(err).NotTo(HaveOccurred())
 
-					Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
-
-ServerName "0.0.0.0"
-
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-
-TypesConfig conf/mime.types
-
-PidFile /tmp/httpd.pid
-
-User nobody
+					expectGolden(t, "web_server_root_absolute.conf", strings.ReplaceAll(string(contents), absolutePath, "/absolute/path"))
+				})
+			})
+		})
 
-Listen "${PORT}"
+		context("when the web server root contains paths that httpd cannot serve", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workingDir, "public", "private"), 0700)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "private", "page.html"), nil, 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "secret.html"), nil, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "outside.html"), nil, 0644)).To(Succeed())
+				Expect(os.Symlink(filepath.Join(workingDir, "outside.html"), filepath.Join(workingDir, "public", "link.html"))).To(Succeed())
+			})
 
-DocumentRoot "/absolute/path"
+			it("reports those paths", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
+				Expect(err).NotTo(HaveOccurred())
 
-DirectoryIndex index.html
+				Expect(buffer.String()).To(ContainSubstring("WARNING: The following paths in '${APP_ROOT}/public' cannot be served by httpd:"))
+				Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("link.html: symbolic link points outside of the web server root to '%s'", filepath.Join(workingDir, "outside.html"))))
+				Expect(buffer.String()).To(ContainSubstring("private: directory is not readable and traversable"))
+				Expect(buffer.String()).To(ContainSubstring("secret.html: file is not readable"))
+				Expect(buffer.String()).To(ContainSubstring("Set $BP_WEB_SERVER_FIX_PERMISSIONS to true to grant the missing permissions during the build."))
 
-ErrorLog /proc/self/fd/2
+				info, err := os.Stat(filepath.Join(workingDir, "public", "secret.html"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			})
 
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
+			context("when BP_WEB_SERVER_FIX_PERMISSIONS is set", func() {
+				it("grants the missing permissions", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerFixPermissions: true})
+					Expect(err).NotTo(HaveOccurred())
 
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
+					Expect(buffer.String()).To(ContainSubstring("Adds read permissions for all users to the web server root"))
+					Expect(buffer.String()).To(ContainSubstring("link.html: symbolic link points outside of the web server root"))
+					Expect(buffer.String()).NotTo(ContainSubstring("file is not readable"))
 
-<Directory "/absolute/path">
-  Require all granted
-</Directory>
+					info, err := os.Stat(filepath.Join(workingDir, "public", "private"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
 
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+					info, err = os.Stat(filepath.Join(workingDir, "public", "secret.html"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
 				})
 			})
 		})
 
 		context("when BP_WEB_SERVER_ENABLE_PUSH_STATE is set", func() {
 			it("creates a config with directices that force all routes to index.html", func() {
-				err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{WebServerPushStateEnabled: true})
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerPushStateEnabled: true})
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
@@ -234,118 +243,167 @@ CustomLog /proc/self/fd/1 common
 				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
+				expectGolden(t, "push_state.conf", string(contents))
+			})
+		})
 
-ServerName "0.0.0.0"
+		context("when BP_WEB_SERVER_BASE_PATH is set", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "404.html"), nil, 0644)).To(Succeed())
+			})
 
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-LoadModule rewrite_module modules/mod_rewrite.so
-LoadModule autoindex_module modules/mod_autoindex.so
+			it("creates a config that serves the web server root under that prefix", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					WebServerBasePath:         "docs/",
+					WebServerPushStateEnabled: true,
+				})
+				Expect(err).NotTo(HaveOccurred())
 
-TypesConfig conf/mime.types
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration to serve web server root under base path '/docs'"))
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that serves '${APP_ROOT}/public/404.html' for the 404 responses under '/docs/'"))
 
-PidFile /tmp/httpd.pid
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
 
-User nobody
+				expectGolden(t, "base_path.conf", string(contents))
+			})
 
-Listen "${PORT}"
+			context("when the base path is only a slash", func() {
+				it("serves the web server root from the document root", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerBasePath: "/"})
+					Expect(err).NotTo(HaveOccurred())
 
-DocumentRoot "${APP_ROOT}/public"
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-DirectoryIndex index.html
+					Expect(string(contents)).To(ContainSubstring(`DocumentRoot "${APP_ROOT}/public"`))
+					Expect(string(contents)).To(ContainSubstring(`ErrorDocument 404 "/404.html"`))
+					Expect(string(contents)).NotTo(ContainSubstring("Alias"))
+				})
+			})
 
-ErrorLog /proc/self/fd/2
+			context("when requests are passed to upstreams", func() {
+				it("passes the requests under the base path to them", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						WebServerBasePath: "/docs",
+						FastCGIUpstream:   "fcgi://127.0.0.1:9000",
+						FastCGIPattern:    "/php",
+						ProxyPath:         "/api",
+						ProxyUpstreams:    "http://api:8080",
+						CachePaths:        "/api/catalog",
+					})
+					Expect(err).NotTo(HaveOccurred())
 
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that passes the requests under '/docs/php/' to the FastCGI upstream 'fcgi://127.0.0.1:9000'"))
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that passes the requests under '/docs/api/' to the upstreams 'http://api:8080'"))
 
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-<Directory "${APP_ROOT}/public">
-  Require all granted
+					Expect(string(contents)).To(ContainSubstring(`<Location "/docs/php/">`))
+					Expect(string(contents)).To(ContainSubstring(`ProxyPass "/docs/api/" "balancer://upstreams/"`))
+					Expect(string(contents)).To(ContainSubstring(`CacheEnable disk "/docs/api/catalog/"`))
+				})
+			})
+		})
 
-  Options +FollowSymLinks
-  IndexIgnore */*
-  RewriteEngine On
-  RewriteCond %{REQUEST_FILENAME} !-f
-  RewriteCond %{REQUEST_FILENAME} !-d
-  RewriteRule (.*) index.html
-</Directory>
+		context("when BP_WEB_SERVER_LOCATIONS is set", func() {
+			it.Before(func() {
+				for _, dir := range []string{"apps/web/dist", "apps/docs/build"} {
+					Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, dir, "index.html"), nil, 0644)).To(Succeed())
+				}
 
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+				bindingResolver.ResolveCall.Returns.BindingSlice = []servicebindings.Binding{
+					{
+						Name: "first",
+						Type: "htpasswd",
+						Path: "some-binding-path",
+						Entries: map[string]*servicebindings.Entry{
+							".htpasswd": servicebindings.NewEntry("some-path"),
+						},
+					},
+				}
 			})
-		})
 
-		context("when BP_WEB_SERVER_FORCE_HTTPS is set", func() {
-			it("creates a config with directives that force redirect to https", func() {
-				err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{WebServerForceHTTPS: true})
+			it("creates a config that serves each directory at its path", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					WebServerLocations: "/=apps/web/dist:push-state,/docs=apps/docs/build:basic-auth",
+				})
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
-				Expect(bindingResolver.ResolveCall.Receives.Provider).To(Equal(""))
-				Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("platform"))
-
-				Expect(buffer.String()).To(ContainSubstring("Adds configuration that forces https redirect"))
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration to serve '${APP_ROOT}/apps/web/dist' at '/'"))
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration to serve '${APP_ROOT}/apps/docs/build' at '/docs/'"))
 
 				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
+				expectGolden(t, "locations.conf", string(contents))
+			})
 
-ServerName "0.0.0.0"
+			context("when BP_WEB_SERVER_FORCE_HTTPS is also set", func() {
+				it("redirects every location to https", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						WebServerForceHTTPS: true,
+						WebServerLocations:  "/=apps/web/dist:push-state,/docs=apps/docs/build:basic-auth",
+					})
+					Expect(err).NotTo(HaveOccurred())
 
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-LoadModule rewrite_module modules/mod_rewrite.so
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-TypesConfig conf/mime.types
+					expectGolden(t, "locations_force_https.conf", string(contents))
+				})
+			})
 
-PidFile /tmp/httpd.pid
+			context("when BP_WEB_SERVER_BASE_PATH is also set", func() {
+				it("serves each location under the base path", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						WebServerBasePath:  "/app",
+						WebServerLocations: "/=apps/web/dist,/docs=apps/docs/build",
+					})
+					Expect(err).NotTo(HaveOccurred())
 
-User nobody
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-Listen "${PORT}"
+					Expect(string(contents)).To(ContainSubstring(`Alias "/app/" "${APP_ROOT}/apps/web/dist/"`))
+					Expect(string(contents)).To(ContainSubstring(`Alias "/app/docs/" "${APP_ROOT}/apps/docs/build/"`))
+					Expect(string(contents)).NotTo(ContainSubstring("DocumentRoot"))
+				})
+			})
+		})
 
-DocumentRoot "${APP_ROOT}/public"
+		context("when BP_WEB_SERVER_FORCE_HTTPS is set", func() {
+			it("creates a config with directives that force redirect to https", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerForceHTTPS: true})
+				Expect(err).NotTo(HaveOccurred())
 
-DirectoryIndex index.html
+				Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
+				Expect(bindingResolver.ResolveCall.Receives.Provider).To(Equal(""))
+				Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("platform"))
 
-ErrorLog /proc/self/fd/2
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that forces https redirect"))
 
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
 
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
+				expectGolden(t, "force_https.conf", string(contents))
+			})
 
-<Directory "${APP_ROOT}/public">
-  Require all granted
+			context("when BP_WEB_SERVER_ENABLE_PUSH_STATE is also set", func() {
+				it("sets up the rewrite engine once for both features", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						WebServerForceHTTPS:       true,
+						WebServerPushStateEnabled: true,
+					})
+					Expect(err).NotTo(HaveOccurred())
 
-  RewriteEngine On
-  RewriteCond %{HTTPS} !=on
-  RewriteCond %{HTTP:X-Forwarded-Proto} !https [NC]
-  RewriteRule ^ https://%{HTTP_HOST}%{REQUEST_URI} [L,R=301]
-</Directory>
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+					expectGolden(t, "push_state_force_https.conf", string(contents))
+				})
 			})
 		})
 
@@ -364,7 +422,7 @@ CustomLog /proc/self/fd/1 common
 			})
 
 			it("creates a config with that requires basic auth", func() {
-				err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(bindingResolver.ResolveCall.Receives.Typ).To(Equal("htpasswd"))
@@ -376,63 +434,645 @@ CustomLog /proc/self/fd/1 common
 				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(string(contents)).To(Equal(`ServerRoot "${SERVER_ROOT}"
+				expectGolden(t, "basic_auth.conf", string(contents))
+			})
+
+			context("when every other feature is also enabled", func() {
+				it("loads each module once", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						MPM:                       "prefork",
+						WebServerBasePath:         "/docs",
+						WebServerForceHTTPS:       true,
+						WebServerPushStateEnabled: true,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					expectGolden(t, "all_features.conf", string(contents))
+				})
+			})
+		})
+
+		context("when BP_HTTPD_MPM is set to prefork", func() {
+			it("loads the prefork MPM and configures it", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{MPM: "prefork"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that uses the 'prefork' MPM"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "prefork.conf", string(contents))
+			})
+		})
+
+		context("when BP_HTTPD_MPM is set to worker", func() {
+			it("loads the worker MPM", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{MPM: "worker"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that uses the 'worker' MPM"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "worker.conf", string(contents))
+			})
+		})
 
-ServerName "0.0.0.0"
+		context("when BP_HTTPD_MODULES is set", func() {
+			it.Before(func() {
+				for _, module := range []string{"headers", "expires", "rewrite"} {
+					Expect(os.WriteFile(filepath.Join(serverRoot, "modules", fmt.Sprintf("mod_%s.so", module)), nil, 0644)).To(Succeed())
+				}
+			})
 
-LoadModule mpm_event_module modules/mod_mpm_event.so
-LoadModule log_config_module modules/mod_log_config.so
-LoadModule mime_module modules/mod_mime.so
-LoadModule dir_module modules/mod_dir.so
-LoadModule authz_core_module modules/mod_authz_core.so
-LoadModule unixd_module modules/mod_unixd.so
-LoadModule authn_core_module modules/mod_authn_core.so
-LoadModule authn_file_module modules/mod_authn_file.so
-LoadModule authz_host_module modules/mod_authz_host.so
-LoadModule authz_user_module modules/mod_authz_user.so
-LoadModule access_compat_module modules/mod_access_compat.so
-LoadModule auth_basic_module modules/mod_auth_basic.so
+			it("loads those modules once", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					Modules:                   "headers, MOD_Expires.so,Rewrite_Module,Headers",
+					WebServerPushStateEnabled: true,
+				})
+				Expect(err).NotTo(HaveOccurred())
 
-TypesConfig conf/mime.types
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that loads the modules 'headers', 'expires', 'rewrite'"))
 
-PidFile /tmp/httpd.pid
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "modules.conf", string(contents))
+			})
 
-User nobody
+			context("when a module is also built from the app", func() {
+				it("loads the built module from its layer instead", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						Modules:      "expires,hello",
+						BuiltModules: []string{"/layers/module-hello/modules/mod_hello.so"},
+					})
+					Expect(err).NotTo(HaveOccurred())
 
-Listen "${PORT}"
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that loads the modules 'expires'"))
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that loads the module built from the app at '/layers/module-hello/modules/mod_hello.so'"))
 
-DocumentRoot "${APP_ROOT}/public"
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
 
-DirectoryIndex index.html
+					Expect(string(contents)).To(ContainSubstring("LoadModule expires_module modules/mod_expires.so\nLoadModule hello_module \"/layers/module-hello/modules/mod_hello.so\"\n"))
+				})
+			})
+		})
 
-ErrorLog /proc/self/fd/2
+		context("when a FastCGI upstream is set", func() {
+			it.Before(func() {
+				Expect(os.Rename(filepath.Join(workingDir, "public", "index.html"), filepath.Join(workingDir, "public", "index.php"))).To(Succeed())
+			})
 
-LogFormat "%h %l %u %t \"%r\" %>s %b" common
-CustomLog /proc/self/fd/1 common
+			it("passes the PHP scripts of the web server root to the upstream", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					FastCGIUpstream: "fcgi://127.0.0.1:9000",
+				})
+				Expect(err).NotTo(HaveOccurred())
 
-<Directory />
-  AllowOverride None
-  Require all denied
-</Directory>
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that passes the requests for '*.php' files to the FastCGI upstream 'fcgi://127.0.0.1:9000'"))
 
-<Directory "${APP_ROOT}/public">
-  Require valid-user
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
 
-  AuthType Basic
-  AuthName "Authentication Required"
-  AuthUserFile "some-binding-path/.htpasswd"
+				expectGolden(t, "fastcgi.conf", string(contents))
+			})
 
-  Order allow,deny
-  Allow from all
-</Directory>
+			context("when BP_WEB_SERVER_FASTCGI_PATTERN is a URL path prefix", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "index.html"), nil, 0644)).To(Succeed())
+				})
 
-<Files ".ht*">
-  Require all denied
-</Files>`), string(contents))
+				it("passes every request under the prefix to the upstream", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						FastCGIUpstream: "unix:/tmp/php-fpm.sock|fcgi://localhost",
+						FastCGIPattern:  "/api/",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that passes the requests under '/api/' to the FastCGI upstream 'unix:/tmp/php-fpm.sock|fcgi://localhost'"))
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					expectGolden(t, "fastcgi_prefix.conf", string(contents))
+				})
+
+				context("when the prefix is the root path", func() {
+					it.Before(func() {
+						Expect(os.Remove(filepath.Join(workingDir, "public", "index.html"))).To(Succeed())
+						Expect(os.Remove(filepath.Join(workingDir, "public", "index.php"))).To(Succeed())
+					})
+
+					it("does not need an index in the web server root", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							FastCGIUpstream: "fcgi://127.0.0.1:9000",
+							FastCGIPattern:  "/",
+							WebServerRoot:   "public",
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(string(contents)).To(ContainSubstring("<Location \"/\">\n  SetHandler \"proxy:${HTTPD_FASTCGI_UPSTREAM}\"\n</Location>"))
+					})
+
+					context("when BP_WEB_SERVER_ROOT is not set", func() {
+						it("detects the web server root without an index", func() {
+							err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+								FastCGIUpstream: "fcgi://127.0.0.1:9000",
+								FastCGIPattern:  "/",
+							})
+							Expect(err).NotTo(HaveOccurred())
+
+							Expect(buffer.String()).To(ContainSubstring("Detected web server root '${APP_ROOT}/public'"))
+						})
+					})
+				})
+			})
+
+			context("failure cases", func() {
+				context("when BP_WEB_SERVER_FASTCGI_PATTERN is a path that is not a prefix", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							FastCGIUpstream: "fcgi://127.0.0.1:9000",
+							FastCGIPattern:  "src/*.php",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_FASTCGI_PATTERN must be a file name pattern such as '*.php' or a URL path prefix such as '/api', got 'src/*.php'"))
+					})
+				})
+
+				context("when the web server root contains no index", func() {
+					it.Before(func() {
+						Expect(os.Remove(filepath.Join(workingDir, "public", "index.php"))).To(Succeed())
+					})
+
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							FastCGIUpstream: "fcgi://127.0.0.1:9000",
+							WebServerRoot:   "public",
+						})
+						Expect(err).To(MatchError("failed: web server root '${APP_ROOT}/public' does not contain an index.php or an index.html"))
+					})
+				})
+			})
+		})
+
+		context("when BP_WEB_SERVER_PROXY_PATH is set", func() {
+			it("balances the requests under that path across the upstreams", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					ProxyPath:                "/api/",
+					ProxyUpstreams:           "http://api-1:8080, http://api-2:8080/",
+					ProxyLBMethod:            "bybusyness",
+					ProxyHealthCheckPath:     "/health",
+					ProxyHealthCheckInterval: "10",
+					ProxyStickySession:       "ROUTEID",
+					ProxyRetry:               "5",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(bindingResolver.ResolveCall.CallCount).To(Equal(2))
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that passes the requests under '/api/' to the upstreams 'http://api-1:8080', 'http://api-2:8080' with the 'bybusyness' method"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "proxy_balancer.conf", string(contents))
+			})
+
+			context("when only the upstreams are set", func() {
+				it("balances the requests by their number without health checks", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						ProxyPath:      "/api",
+						ProxyUpstreams: "https://api.example.com",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(strings.Join([]string{
+						`<Proxy "balancer://upstreams">`,
+						`  BalancerMember "https://api.example.com"`,
+						`  ProxySet lbmethod=byrequests`,
+						`</Proxy>`,
+					}, "\n")))
+					Expect(string(contents)).To(ContainSubstring("LoadModule lbmethod_byrequests_module modules/mod_lbmethod_byrequests.so"))
+					Expect(string(contents)).NotTo(ContainSubstring("proxy_hcheck"))
+					Expect(string(contents)).NotTo(ContainSubstring("Set-Cookie"))
+				})
+			})
+
+			context("when only the health check path is set", func() {
+				it("checks the upstreams at the default interval", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						ProxyPath:            "/api",
+						ProxyUpstreams:       "http://api:8080",
+						ProxyHealthCheckPath: "/ready",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`BalancerMember "http://api:8080" hcmethod=GET hcuri=/ready hcinterval=30`))
+				})
+			})
+
+			context("when the upstreams come from a binding", func() {
+				it.Before(func() {
+					bindingResolver.ResolveCall.Stub = func(typ, provider, platformDir string) ([]servicebindings.Binding, error) {
+						if typ != "upstream" {
+							return nil, nil
+						}
+
+						return []servicebindings.Binding{
+							{
+								Name: "api",
+								Type: "upstream",
+								Path: "some-binding-path",
+								Entries: map[string]*servicebindings.Entry{
+									"urls": servicebindings.NewWithValue([]byte("http://api-1:8080\nhttp://api-2:8080\n")),
+								},
+							},
+						}, nil
+					}
+				})
+
+				it("balances the requests across the upstreams of the binding", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						ProxyPath: "/api",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`BalancerMember "http://api-1:8080"`))
+					Expect(string(contents)).To(ContainSubstring(`BalancerMember "http://api-2:8080"`))
+				})
+
+				context("when BP_WEB_SERVER_PROXY_UPSTREAMS is also set", func() {
+					it("uses the upstreams of the variable", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api-3:8080",
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(buffer.String()).To(ContainSubstring("BP_WEB_SERVER_PROXY_UPSTREAMS takes precedence over the upstreams of binding 'api'"))
+
+						contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(string(contents)).To(ContainSubstring(`BalancerMember "http://api-3:8080"`))
+						Expect(string(contents)).NotTo(ContainSubstring(`BalancerMember "http://api-1:8080"`))
+					})
+				})
+			})
+
+			context("failure cases", func() {
+				context("when there are no upstreams", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath: "/api",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_PROXY_PATH is set, but neither BP_WEB_SERVER_PROXY_UPSTREAMS nor a binding of type 'upstream' provide any upstreams"))
+					})
+				})
+
+				context("when an upstream is not an http URL", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api-1:8080,api-2:8080",
+						})
+						Expect(err).To(MatchError("failed: upstream 'api-2:8080' must be an http or https URL"))
+					})
+				})
+
+				context("when the method is not supported", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api:8080",
+							ProxyLBMethod:  "heartbeat",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_PROXY_LB_METHOD must be one of 'byrequests' or 'bybusyness', got 'heartbeat'"))
+					})
+				})
+
+				context("when the health check interval is not a number", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:                "/api",
+							ProxyUpstreams:           "http://api:8080",
+							ProxyHealthCheckInterval: "10s",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_PROXY_HEALTH_CHECK_INTERVAL must be a positive number of seconds, got '10s'"))
+					})
+				})
+
+				context("when the upstreams are set without a path", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyUpstreams: "http://api:8080",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_PROXY_UPSTREAMS is set without BP_WEB_SERVER_PROXY_PATH, which selects the requests that are passed to them"))
+					})
+				})
+
+				context("when the upstream binding does not contain the urls entry", func() {
+					it.Before(func() {
+						bindingResolver.ResolveCall.Returns.BindingSlice = []servicebindings.Binding{
+							{Name: "api", Type: "upstream", Entries: map[string]*servicebindings.Entry{}},
+						}
+					})
+
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath: "/api",
+						})
+						Expect(err).To(MatchError("failed: binding of type 'upstream' does not contain required entry 'urls'"))
+					})
+				})
+			})
+		})
+
+		context("when BP_WEB_SERVER_CACHE_PATHS is set", func() {
+			it("caches the responses of the upstreams under those paths", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					ProxyPath:      "/api",
+					ProxyUpstreams: "http://api:8080",
+					CachePaths:     "/api/catalog/, /api/search",
+					CacheMaxSize:   "512M",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that caches the responses under '/api/catalog/', '/api/search/' on disk up to a size of 512M"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "cache.conf", string(contents))
+			})
+
+			context("when the paths are passed to a FastCGI upstream", func() {
+				it("caches the responses under any path that holds scripts", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						FastCGIUpstream: "fcgi://127.0.0.1:9000",
+						CachePaths:      "/",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that caches the responses under '/' on disk up to a size of 100M"))
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`CacheEnable disk "/"`))
+				})
+			})
+
+			context("failure cases", func() {
+				context("when a path is not passed to an upstream", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api:8080",
+							CachePaths:     "/apidocs",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_CACHE_PATHS must only contain proxied paths, but the requests under '/apidocs/' are not passed to an upstream"))
+					})
+				})
+
+				context("when a path is not a URL path", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api:8080",
+							CachePaths:     "api",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_CACHE_PATHS must be a comma separated list of URL paths, got 'api'"))
+					})
+				})
+
+				context("when the max size is not a size", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							ProxyPath:      "/api",
+							ProxyUpstreams: "http://api:8080",
+							CachePaths:     "/api",
+							CacheMaxSize:   "1 GB",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_CACHE_MAX_SIZE must be a number of bytes with an optional 'K', 'M' or 'G' suffix, got '1 GB'"))
+					})
+				})
+			})
+		})
+
+		context("when values are redacted from the access log", func() {
+			it("logs the path and the sanitized query separately", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+					LogRedactQueryParams: "token, access_token",
+					LogRedactHeaders:     "user-agent",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that masks the query parameters 'token', 'access_token' in the access log"))
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that masks the headers 'User-Agent' in the access log"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "log_redaction.conf", string(contents))
+			})
+
+			context("when only headers are redacted", func() {
+				it("logs the query without masking any parameters", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						LogRedactHeaders: "User-Agent",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`LogFormat "%h %l %u %t \"%m %U %H\" \"%{LOG_QUERY}e\" %>s %b \"%{Referer}i\" \"%{LOG_MASKED_USER_AGENT}e\" \"%{X-Request-ID}i\" \"%{traceparent}i\"" redacted`))
+					Expect(string(contents)).To(ContainSubstring("SetEnvIf User-Agent . LOG_MASKED_USER_AGENT=REDACTED"))
+					Expect(string(contents)).NotTo(ContainSubstring("LOG_REFERER"))
+					Expect(string(contents)).NotTo(ContainSubstring(",N]"))
+				})
+			})
+
+			context("when the Referer header is masked", func() {
+				it("does not copy it to mask the query parameters in it", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						LogRedactQueryParams: "token",
+						LogRedactHeaders:     "Referer",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`\"%{LOG_MASKED_REFERER}e\"`))
+					Expect(string(contents)).To(ContainSubstring("RewriteRule ^ - [E=LOG_QUERY:%1REDACTED%2,N]"))
+					Expect(string(contents)).NotTo(ContainSubstring("LOG_REFERER"))
+				})
+			})
+
+			context("failure cases", func() {
+				context("when a query parameter is not a name", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							LogRedactQueryParams: "token=secret",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_LOG_REDACT_QUERY_PARAMS must be a comma separated list of query parameter names, got 'token=secret'"))
+					})
+				})
+
+				context("when a header is not recorded by the access log", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+							LogRedactHeaders: "User-Agent,Authorization",
+						})
+						Expect(err).To(MatchError("failed: BP_WEB_SERVER_LOG_REDACT_HEADERS can only contain the headers that the access log records, 'Referer', 'User-Agent', 'X-Request-ID', 'traceparent', got 'Authorization'"))
+					})
+				})
+			})
+		})
+
+		context("when the app provides config fragments", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "httpd.conf.d", "directory"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "httpd.conf.d", "vhosts"), os.ModePerm)).To(Succeed())
+
+				for _, file := range []string{"headers.conf", "directory/options.conf", "vhosts/www.example.com.conf", "vhosts/api.example.com.conf"} {
+					Expect(os.WriteFile(filepath.Join(workingDir, "httpd.conf.d", file), nil, 0644)).To(Succeed())
+				}
+			})
+
+			it("includes them at their hook points", func() {
+				err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Adds configuration that includes the fragments in '${APP_ROOT}/httpd.conf.d'"))
+				Expect(buffer.String()).To(ContainSubstring("Virtual host from '${APP_ROOT}/httpd.conf.d/vhosts/api.example.com.conf'"))
+				Expect(buffer.String()).To(ContainSubstring("Virtual host from '${APP_ROOT}/httpd.conf.d/vhosts/www.example.com.conf'"))
+
+				contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+				Expect(err).NotTo(HaveOccurred())
+
+				expectGolden(t, "config_fragments.conf", string(contents))
+			})
+
+			context("when values are redacted from the access log", func() {
+				it("lets every virtual host inherit the redaction rules", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{LogRedactQueryParams: "token"})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					rules := strings.Index(string(contents), "RewriteEngine On\nRewriteOptions InheritDownBefore\n")
+					Expect(rules).To(BeNumerically(">", 0))
+					Expect(rules).To(BeNumerically("<", strings.Index(string(contents), `IncludeOptional "${HTTPD_CONF_D}/*.conf"`)))
+				})
+			})
+
+			context("when BP_WEB_SERVER_CONF_DIR is set", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "config", "httpd"), os.ModePerm)).To(Succeed())
+				})
+
+				it("includes the fragments from that directory instead", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerConfDir: "config/httpd"})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(HaveSuffix("\nIncludeOptional \"${APP_ROOT}/config/httpd/*.conf\"\n"))
+					Expect(string(contents)).NotTo(ContainSubstring("httpd.conf.d"))
+					Expect(string(contents)).NotTo(ContainSubstring("VirtualHost"))
+				})
+			})
+
+			context("when the build plan requires a directory that does not exist yet", func() {
+				it("includes its fragments when they exist at launch", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{PlanConfDir: "/layers/php/conf.d"})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(buffer.String()).To(ContainSubstring("Adds configuration that includes the fragments in '/layers/php/conf.d'"))
+
+					contents, err := os.ReadFile(filepath.Join(workingDir, "httpd.conf"))
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(ContainSubstring(`IncludeOptional "/layers/php/conf.d/directory/*.conf"`))
+					Expect(string(contents)).To(HaveSuffix("\nIncludeOptional \"/layers/php/conf.d/*.conf\"\n"))
+					Expect(string(contents)).NotTo(ContainSubstring("httpd.conf.d"))
+				})
 			})
 		})
 
 		context("failure cases", func() {
+			context("when BP_HTTPD_MPM is not a supported MPM", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{MPM: "winnt"})
+					Expect(err).To(MatchError("failed: BP_HTTPD_MPM must be one of 'event', 'worker' or 'prefork', got 'winnt'"))
+				})
+			})
+
+			context("when BP_HTTPD_MODULES contains a module that is not installed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(serverRoot, "modules", "mod_headers.so"), nil, 0644)).To(Succeed())
+				})
+
+				it("returns an error that suggests the closest module", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{Modules: "hedaers"})
+					Expect(err).To(MatchError("failed: BP_HTTPD_MODULES contains 'hedaers', which is not a module of the installed Apache HTTP Server, did you mean 'headers'?"))
+				})
+
+				context("when no module comes close", func() {
+					it("returns an error", func() {
+						err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{Modules: "php7"})
+						Expect(err).To(MatchError("failed: BP_HTTPD_MODULES contains 'php7', which is not a module of the installed Apache HTTP Server"))
+					})
+				})
+			})
+
+			context("when BP_HTTPD_MODULES contains an MPM", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{Modules: "mpm_worker"})
+					Expect(err).To(MatchError("failed: BP_HTTPD_MODULES cannot load the 'mpm_worker' module, set BP_HTTPD_MPM to select the MPM"))
+				})
+			})
+
+			context("when the configured config fragments directory does not exist", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerConfDir: "config/httpd"})
+					Expect(err).To(MatchError("failed: config fragments directory '${APP_ROOT}/config/httpd' does not exist"))
+				})
+			})
+
+			context("when the installed server does not provide the MPM", func() {
+				it.Before(func() {
+					Expect(os.Remove(filepath.Join(serverRoot, "modules", "mod_mpm_worker.so"))).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{MPM: "worker"})
+					Expect(err).To(MatchError("failed: the installed Apache HTTP Server does not provide the 'worker' MPM"))
+				})
+			})
+
 			context("when the config file cannot be created", func() {
 				it.Before(func() {
 					Expect(os.Chmod(workingDir, 0000)).To(Succeed())
@@ -443,7 +1083,7 @@ CustomLog /proc/self/fd/1 common
 				})
 
 				it("returns an error", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 					Expect(err).To(MatchError(ContainSubstring("permission denied")))
 				})
 			})
@@ -453,7 +1093,7 @@ CustomLog /proc/self/fd/1 common
 					bindingResolver.ResolveCall.Returns.Error = errors.New("failed to resolve binding")
 				})
 				it("returns an error", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 					Expect(err).To(MatchError("failed to resolve binding"))
 				})
 			})
@@ -480,11 +1120,70 @@ CustomLog /proc/self/fd/1 common
 					}
 				})
 				it("returns an error", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 					Expect(err).To(MatchError("failed: binding resolver found more than one binding of type 'htpasswd'"))
 				})
 			})
 
+			context("when no web server root can be detected", func() {
+				it.Before(func() {
+					Expect(os.RemoveAll(filepath.Join(workingDir, "public"))).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
+					Expect(err).To(MatchError("failed: could not find a web server root: none of public, dist, build, out, _site contain an index.html, set BP_WEB_SERVER_ROOT to the directory that contains your static files"))
+				})
+			})
+
+			context("when the configured web server root does not exist", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerRoot: "htdocs"})
+					Expect(err).To(MatchError("failed: web server root '${APP_ROOT}/htdocs' does not exist"))
+				})
+			})
+
+			context("when the configured web server root does not contain an index.html", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "htdocs"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerRoot: "htdocs"})
+					Expect(err).To(MatchError("failed: web server root '${APP_ROOT}/htdocs' does not contain an index.html"))
+				})
+			})
+
+			context("when BP_WEB_SERVER_ROOT and BP_WEB_SERVER_LOCATIONS are both set", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{
+						WebServerRoot:      "htdocs",
+						WebServerLocations: "/docs=docs",
+					})
+					Expect(err).To(MatchError("failed: BP_WEB_SERVER_ROOT and BP_WEB_SERVER_LOCATIONS cannot be set at the same time"))
+				})
+			})
+
+			context("when BP_WEB_SERVER_LOCATIONS is malformed", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerLocations: "docs"})
+					Expect(err).To(MatchError(`failed to parse BP_WEB_SERVER_LOCATIONS: invalid mapping "docs": expected '<url-path>=<directory>'`))
+
+					err = generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerLocations: "/docs=docs:gzip"})
+					Expect(err).To(MatchError(`failed to parse BP_WEB_SERVER_LOCATIONS: unknown option "gzip" in mapping "/docs=docs:gzip"`))
+
+					err = generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerLocations: "/docs=docs,/docs/=other"})
+					Expect(err).To(MatchError("failed to parse BP_WEB_SERVER_LOCATIONS: path '/docs/' is mapped more than once"))
+				})
+			})
+
+			context("when a location requires basic auth without an htpasswd binding", func() {
+				it("returns an error", func() {
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{WebServerLocations: "/docs=public:basic-auth"})
+					Expect(err).To(MatchError("failed: location '/docs/' requires basic authentication but no binding of type 'htpasswd' was found"))
+				})
+			})
+
 			context("when the binding is missing the required entry", func() {
 				it.Before(func() {
 					bindingResolver.ResolveCall.Returns.BindingSlice = []servicebindings.Binding{
@@ -499,7 +1198,7 @@ CustomLog /proc/self/fd/1 common
 					}
 				})
 				it("returns an error", func() {
-					err := generateHTTPDConfig.Generate(workingDir, "platform", httpd.BuildEnvironment{})
+					err := generateHTTPDConfig.Generate(workingDir, "platform", serverRoot, httpd.BuildEnvironment{})
 					Expect(err).To(MatchError("failed: binding of type 'htpasswd' does not contain required entry '.htpasswd'"))
 				})
 			})
@@ -0,0 +1,643 @@
+package httpd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// configFeature is an independent unit of the generated httpd.conf. Each
+// feature declares the modules that it needs, the directives that it adds to
+// the server config and the directives that it adds to the <Directory> block
+// of every location that it applies to. A feature that is not enabled is the
+// zero value and contributes nothing.
+type configFeature struct {
+	// Modules are the names of the modules to load, such as "rewrite" for
+	// mod_rewrite.
+	Modules []string
+
+	// ModuleFiles are the paths of modules that are not part of the installed
+	// server, which are loaded by the name in their file name.
+	ModuleFiles []string
+
+	// Server holds blocks of server config directives. The blocks are
+	// separated by a blank line.
+	Server [][]string
+
+	// DirectorySetup returns the directives that prepare the <Directory> block
+	// of a location for the rules of the feature, such as "RewriteEngine On".
+	// Setup directives are shared between features and only written ahead of
+	// the rules of the first feature that asks for them.
+	DirectorySetup func(location webServerLocation) []string
+
+	// DirectoryRules returns the block of directives that the feature adds to
+	// the <Directory> block of a location.
+	DirectoryRules func(location webServerLocation) []string
+
+	// Final holds blocks of server config directives that are written after
+	// the <Directory> blocks of the locations, so that they can override any
+	// of the generated directives.
+	Final [][]string
+}
+
+// configFeatures returns the features of the config in the order in which
+// their modules and directives are written.
+func configFeatures(data httpdConfData) []configFeature {
+	return []configFeature{
+		mpmFeature(data.MPM),
+		runtimeFeature(),
+		listenFeature(),
+		mimeFeature(),
+		locationsFeature(data.Locations),
+		directoryIndexFeature(data.DirectoryIndex),
+		loggingFeature(len(data.CachePaths) > 0, data.LogRedaction),
+		requestIDFeature(),
+		accessFeature(),
+		errorDocumentsFeature(),
+		pushStateFeature(data.PushStateEnabled()),
+		forceHTTPSFeature(data.WebServerForceHTTPS),
+		basicAuthFeature(data.BasicAuthFile, data.BasicAuthEnabled()),
+		fastCGIFeature(data.FastCGIUpstream != "", data.FastCGIPattern),
+		proxyBalancerFeature(data.Balancer),
+		cacheFeature(data.CachePaths),
+		modulesFeature(data.ExtraModules, data.BuiltModules),
+		configFragmentsFeature(data.Fragments),
+	}
+}
+
+func mpmFeature(mpm string) configFeature {
+	directives := []string{
+		"ServerLimit ${HTTPD_SERVER_LIMIT}",
+		"ThreadLimit ${HTTPD_THREADS_PER_CHILD}",
+		"ThreadsPerChild ${HTTPD_THREADS_PER_CHILD}",
+		"MaxRequestWorkers ${HTTPD_MAX_REQUEST_WORKERS}",
+	}
+
+	if mpm == "prefork" {
+		directives = []string{
+			"StartServers 1",
+			"MinSpareServers 1",
+			"MaxSpareServers 5",
+			"ServerLimit ${HTTPD_SERVER_LIMIT}",
+			"MaxRequestWorkers ${HTTPD_MAX_REQUEST_WORKERS}",
+			"MaxConnectionsPerChild 10000",
+		}
+	}
+
+	return configFeature{
+		Modules: []string{fmt.Sprintf("mpm_%s", mpm)},
+		Server:  [][]string{directives},
+	}
+}
+
+func runtimeFeature() configFeature {
+	return configFeature{
+		Modules: []string{"unixd"},
+		Server: [][]string{
+			{`DefaultRuntimeDir "${HTTPD_RUNTIME_DIR}"`},
+			{`PidFile "${HTTPD_RUNTIME_DIR}/httpd.pid"`},
+			{`User "${HTTPD_USER}"`},
+		},
+	}
+}
+
+func listenFeature() configFeature {
+	return configFeature{
+		Server: [][]string{{`Listen "${PORT}"`}},
+	}
+}
+
+func mimeFeature() configFeature {
+	return configFeature{
+		Modules: []string{"mime"},
+		Server:  [][]string{{"TypesConfig conf/mime.types"}},
+	}
+}
+
+func locationsFeature(locations []webServerLocation) configFeature {
+	var feature configFeature
+	for _, location := range locations {
+		if location.Path == "" {
+			feature.Server = append(feature.Server, []string{fmt.Sprintf("DocumentRoot %q", location.Root)})
+			continue
+		}
+
+		feature.Modules = []string{"alias"}
+		feature.Server = append(feature.Server, []string{
+			fmt.Sprintf(`Alias "%s/" "%s/"`, location.Path, location.Root),
+			fmt.Sprintf(`RedirectMatch 301 "^%s$" "%s/"`, location.Path, location.Path),
+		})
+	}
+	return feature
+}
+
+func directoryIndexFeature(indexes []string) configFeature {
+	return configFeature{
+		Modules: []string{"dir"},
+		Server:  [][]string{{fmt.Sprintf("DirectoryIndex %s", strings.Join(indexes, " "))}},
+	}
+}
+
+// loggingFeature writes the logs to the output streams of the container. Both
+// logs record the ID of the request, and the access log records the W3C
+// traceparent header of the request along with whether the cache served the
+// response when it is enabled. When values are redacted, the access log
+// switches to a format that records the path and the query of the request
+// separately, along with the headers in redactedLogHeaders.
+func loggingFeature(cache bool, redaction logRedaction) configFeature {
+	feature := configFeature{
+		Modules: []string{"log_config"},
+		Server: [][]string{
+			{
+				`ErrorLogFormat "[%{u}t] [%-m:%l] [pid %P:tid %T] [client\ %a] [request\ %{X-Request-ID}i] %M"`,
+				"ErrorLog /proc/self/fd/2",
+			},
+		},
+	}
+
+	format := `%h %l %u %t \"%r\" %>s %b \"%{X-Request-ID}i\" \"%{traceparent}i\"`
+	name := "access"
+
+	var redactions [][]string
+	if redaction.enabled() {
+		feature.Modules = append(feature.Modules, "rewrite", "setenvif")
+
+		fields := []string{`%h %l %u %t \"%m %U %H\" \"%{LOG_QUERY}e\" %>s %b`}
+		var masks []string
+		for _, header := range redactedLogHeaders {
+			field := fmt.Sprintf("%%{%s}i", header)
+			if header == "Referer" && len(redaction.QueryParams) > 0 {
+				field = "%{LOG_REFERER}e"
+			}
+
+			if redaction.masks(header) {
+				variable := fmt.Sprintf("LOG_MASKED_%s", strings.ToUpper(strings.ReplaceAll(header, "-", "_")))
+				masks = append(masks, fmt.Sprintf("SetEnvIf %s . %s=%s", header, variable, RedactedValue))
+				field = fmt.Sprintf("%%{%s}e", variable)
+			}
+
+			fields = append(fields, fmt.Sprintf(`\"%s\"`, field))
+		}
+
+		format = strings.Join(fields, " ")
+		name = "redacted"
+
+		redactions = append(redactions, queryRedactionRules(redaction.QueryParams, !redaction.masks("Referer")))
+		if len(masks) > 0 {
+			redactions = append(redactions, masks)
+		}
+	}
+
+	if cache {
+		format += ` \"%{X-Cache}o\"`
+	}
+
+	feature.Server = append(feature.Server, []string{
+		fmt.Sprintf(`LogFormat "%s" %s`, format, name),
+		fmt.Sprintf("CustomLog /proc/self/fd/1 %s", name),
+	})
+	feature.Server = append(feature.Server, redactions...)
+
+	return feature
+}
+
+// redactedLogHeaders are the request headers that the access log records when
+// values are redacted. The headers that BP_WEB_SERVER_LOG_REDACT_HEADERS
+// lists are recorded as REDACTED when they are sent.
+var redactedLogHeaders = []string{"Referer", "User-Agent", "X-Request-ID", "traceparent"}
+
+// queryRedactionRules copy the query string of a request into the LOG_QUERY
+// variable, and its Referer header into LOG_REFERER unless it is masked as a
+// whole, in which the values of the given query parameters are then masked one
+// at a time. Every masked value starts a new round of the rewrite rules, which
+// end once no value is left, while the request itself is never rewritten. The
+// Referer header is copied by mod_setenvif, as a header that mod_rewrite reads
+// is added to the Vary header of the response. Every virtual host, including
+// the ones of config fragments, runs the rules ahead of its own.
+func queryRedactionRules(params []string, referer bool) []string {
+	rules := []string{
+		"RewriteEngine On",
+		"RewriteOptions InheritDownBefore",
+		"RewriteCond %{ENV:LOG_REDACTED} !=1",
+		"RewriteRule ^ - [E=LOG_REDACTED:1,E=LOG_QUERY:%{QUERY_STRING}]",
+	}
+
+	if len(params) == 0 {
+		return rules
+	}
+
+	variables := []string{"LOG_QUERY"}
+	if referer {
+		rules = append([]string{`SetEnvIf Referer "^(.*)$" LOG_REFERER=$1`}, rules...)
+		variables = append(variables, "LOG_REFERER")
+	}
+
+	pattern := queryParamsRegexp(params)
+	for _, variable := range variables {
+		rules = append(rules,
+			fmt.Sprintf(`RewriteCond %%{ENV:%s} "%s" [NC]`, variable, pattern),
+			fmt.Sprintf("RewriteRule ^ - [E=%s:%%1%s%%2,N]", variable, RedactedValue),
+		)
+	}
+
+	return rules
+}
+
+// requestIDFeature gives every request an ID that is passed on to upstreams
+// and returned to the client in the X-Request-ID header. An ID that the
+// client or a load balancer in front of httpd sends is kept, and any other
+// request is given the one that mod_unique_id generates.
+func requestIDFeature() configFeature {
+	return configFeature{
+		Modules: []string{"unique_id", "headers"},
+		Server: [][]string{
+			{
+				`RequestHeader setifempty X-Request-ID "%{UNIQUE_ID}e"`,
+				`Header always set X-Request-ID "expr=%{req:X-Request-ID}" "expr=-n %{req:X-Request-ID}"`,
+			},
+		},
+	}
+}
+
+func accessFeature() configFeature {
+	return configFeature{
+		Modules: []string{"authz_core"},
+		Server: [][]string{
+			{
+				"<Directory />",
+				"  AllowOverride None",
+				"  Require all denied",
+				"</Directory>",
+			},
+			{
+				`<Files ".ht*">`,
+				"  Require all denied",
+				"</Files>",
+			},
+		},
+		DirectoryRules: func(location webServerLocation) []string {
+			if location.BasicAuth {
+				return []string{"Require valid-user"}
+			}
+			return []string{"Require all granted"}
+		},
+	}
+}
+
+// errorDocumentsFeature serves the error pages of a location in place of the
+// error responses of httpd. The pages are served from the URL path of the
+// location, so that they are found under the base path.
+func errorDocumentsFeature() configFeature {
+	return configFeature{
+		DirectoryRules: func(location webServerLocation) []string {
+			var rules []string
+			for _, status := range location.ErrorDocuments {
+				rules = append(rules, fmt.Sprintf(`ErrorDocument %s "%s/%s.html"`, status, location.Path, status))
+			}
+			return rules
+		},
+	}
+}
+
+func pushStateFeature(enabled bool) configFeature {
+	if !enabled {
+		return configFeature{}
+	}
+
+	return configFeature{
+		Modules: []string{"rewrite", "autoindex"},
+		DirectorySetup: func(location webServerLocation) []string {
+			if !location.PushState {
+				return nil
+			}
+
+			setup := []string{"Options +FollowSymLinks", "IndexIgnore */*", "RewriteEngine On"}
+			if location.Path != "" {
+				setup = append(setup, fmt.Sprintf(`RewriteBase "%s/"`, location.Path))
+			}
+			return setup
+		},
+		DirectoryRules: func(location webServerLocation) []string {
+			if !location.PushState {
+				return nil
+			}
+
+			return []string{
+				"RewriteCond %{REQUEST_FILENAME} !-f",
+				"RewriteCond %{REQUEST_FILENAME} !-d",
+				"RewriteRule (.*) index.html",
+			}
+		},
+	}
+}
+
+func forceHTTPSFeature(enabled bool) configFeature {
+	if !enabled {
+		return configFeature{}
+	}
+
+	return configFeature{
+		Modules: []string{"rewrite"},
+		DirectorySetup: func(webServerLocation) []string {
+			return []string{"RewriteEngine On"}
+		},
+		DirectoryRules: func(webServerLocation) []string {
+			return []string{
+				"RewriteCond %{HTTPS} !=on",
+				"RewriteCond %{HTTP:X-Forwarded-Proto} !https [NC]",
+				"RewriteRule ^ https://%{HTTP_HOST}%{REQUEST_URI} [L,R=301]",
+			}
+		},
+	}
+}
+
+func basicAuthFeature(basicAuthFile string, enabled bool) configFeature {
+	if !enabled {
+		return configFeature{}
+	}
+
+	return configFeature{
+		Modules: []string{"authn_core", "authn_file", "authz_host", "authz_user", "access_compat", "auth_basic"},
+		DirectoryRules: func(location webServerLocation) []string {
+			if !location.BasicAuth {
+				return nil
+			}
+
+			return []string{
+				"AuthType Basic",
+				`AuthName "Authentication Required"`,
+				fmt.Sprintf("AuthUserFile %q", basicAuthFile),
+				"",
+				"Order allow,deny",
+				"Allow from all",
+			}
+		},
+	}
+}
+
+// fastCGIFeature passes the requests that the pattern selects to the FastCGI
+// upstream in HTTPD_FASTCGI_UPSTREAM. A file name pattern only passes on the
+// scripts that exist in the web server root, while a URL path prefix passes on
+// every request under it. The upstream is given the path of the script in
+// SCRIPT_FILENAME rather than the proxy URL.
+func fastCGIFeature(enabled bool, pattern string) configFeature {
+	if !enabled {
+		return configFeature{}
+	}
+
+	handler := `SetHandler "proxy:${HTTPD_FASTCGI_UPSTREAM}"`
+
+	var block []string
+	if prefix, ok := fastCGIPrefix(pattern); ok {
+		block = []string{
+			fmt.Sprintf(`<Location "%s/">`, prefix),
+			"  " + handler,
+			"</Location>",
+		}
+	} else {
+		block = []string{
+			fmt.Sprintf("<Files %q>", pattern),
+			`  <If "-f %{REQUEST_FILENAME}">`,
+			"    " + handler,
+			"  </If>",
+			"</Files>",
+		}
+	}
+
+	return configFeature{
+		Modules: []string{"proxy", "proxy_fcgi"},
+		Server: [][]string{
+			block,
+			{`ProxyFCGISetEnvIf "true" SCRIPT_FILENAME "%{REQUEST_FILENAME}"`},
+		},
+	}
+}
+
+// proxyBalancerFeature passes the requests under the path of the balancer to
+// its upstreams. Every upstream is a member of the balancer with a route
+// that the sticky session cookie refers to, and the health checks of
+// mod_proxy_hcheck take the upstreams that fail them out of rotation.
+func proxyBalancerFeature(balancer proxyBalancer) configFeature {
+	if len(balancer.Members) == 0 {
+		return configFeature{}
+	}
+
+	feature := configFeature{
+		Modules: []string{"proxy", "proxy_http", "proxy_balancer", "slotmem_shm", fmt.Sprintf("lbmethod_%s", balancer.Method)},
+	}
+
+	var parameters []string
+	if balancer.Retry != "" {
+		parameters = append(parameters, fmt.Sprintf("retry=%s", balancer.Retry))
+	}
+
+	if balancer.HealthCheckInterval > 0 {
+		feature.Modules = append(feature.Modules, "watchdog", "proxy_hcheck")
+		if balancer.HealthCheckPath != "" {
+			parameters = append(parameters, "hcmethod=GET", fmt.Sprintf("hcuri=%s", balancer.HealthCheckPath))
+		} else {
+			parameters = append(parameters, "hcmethod=TCP")
+		}
+		parameters = append(parameters, fmt.Sprintf("hcinterval=%d", balancer.HealthCheckInterval))
+	}
+
+	set := []string{fmt.Sprintf("lbmethod=%s", balancer.Method)}
+	if balancer.StickySession != "" {
+		set = append(set, fmt.Sprintf("stickysession=%s", balancer.StickySession))
+	}
+
+	proxy := []string{`<Proxy "balancer://upstreams">`}
+	for i, member := range balancer.Members {
+		directive := fmt.Sprintf("  BalancerMember %q", member)
+		if balancer.StickySession != "" {
+			directive = fmt.Sprintf("%s route=%d", directive, i+1)
+		}
+		proxy = append(proxy, strings.Join(append([]string{directive}, parameters...), " "))
+	}
+	proxy = append(proxy, fmt.Sprintf("  ProxySet %s", strings.Join(set, " ")), "</Proxy>")
+
+	feature.Server = [][]string{
+		proxy,
+		{
+			fmt.Sprintf(`ProxyPass "%s/" "balancer://upstreams/"`, balancer.Path),
+			fmt.Sprintf(`ProxyPassReverse "%s/" "balancer://upstreams/"`, balancer.Path),
+		},
+	}
+
+	if balancer.StickySession != "" {
+		feature.Modules = append(feature.Modules, "headers")
+		feature.Server = append(feature.Server, []string{
+			fmt.Sprintf(`Header add Set-Cookie "%s=.%%{BALANCER_WORKER_ROUTE}e; path=%s/" env=BALANCER_ROUTE_CHANGED`, balancer.StickySession, balancer.Path),
+		})
+	}
+
+	return feature
+}
+
+// cacheFeature caches the responses of the upstreams under the given paths in
+// the directory that the exec.d helper creates at launch, where htcacheclean
+// keeps it under HTTPD_CACHE_MAX_SIZE. Responses are only cached as far as
+// their Cache-Control and Expires headers allow, and the X-Cache header
+// reports whether the cache served them.
+func cacheFeature(paths []string) configFeature {
+	if len(paths) == 0 {
+		return configFeature{}
+	}
+
+	enable := make([]string, 0, len(paths))
+	for _, path := range paths {
+		enable = append(enable, fmt.Sprintf(`CacheEnable disk "%s/"`, path))
+	}
+
+	// The cache is consulted after the access checks, so that it does not
+	// serve the responses of protected paths to anyone.
+	return configFeature{
+		Modules: []string{"cache", "cache_disk"},
+		Server: [][]string{
+			{
+				`CacheRoot "${HTTPD_CACHE_ROOT}"`,
+				"CacheQuickHandler off",
+				"CacheHeader on",
+			},
+			enable,
+		},
+	}
+}
+
+func modulesFeature(modules, files []string) configFeature {
+	return configFeature{
+		Modules:     modules,
+		ModuleFiles: files,
+	}
+}
+
+func configFragmentsFeature(fragments configFragments) configFeature {
+	// The fragments of other buildpacks come first, so that the ones of the
+	// app can override them.
+	feature := configFeature{
+		Final: [][]string{{`IncludeOptional "${HTTPD_CONF_D}/*.conf"`}},
+	}
+
+	if fragments.Global != "" {
+		feature.Final = append(feature.Final, []string{fmt.Sprintf("IncludeOptional %q", fragments.Global)})
+	}
+
+	if len(fragments.VirtualHosts) > 0 {
+		// The first virtual host answers the requests for any other name, so
+		// it is left empty to serve them with the main server config.
+		feature.Final = append(feature.Final, []string{
+			`<VirtualHost "*:${PORT}">`,
+			`  ServerName "0.0.0.0"`,
+			"</VirtualHost>",
+		})
+	}
+
+	for _, file := range fragments.VirtualHosts {
+		feature.Final = append(feature.Final, []string{
+			`<VirtualHost "*:${PORT}">`,
+			fmt.Sprintf("  ServerName %q", strings.TrimSuffix(filepath.Base(file), ".conf")),
+			fmt.Sprintf("  Include %q", file),
+			"</VirtualHost>",
+		})
+	}
+
+	if fragments.Directory != "" {
+		feature.DirectoryRules = func(webServerLocation) []string {
+			return []string{fmt.Sprintf("IncludeOptional %q", fragments.Directory)}
+		}
+	}
+
+	return feature
+}
+
+// renderHTTPDConf writes the given features out as an httpd.conf. Modules
+// are loaded in the order in which the features first ask for them, and
+// repeated blocks and setup directives are written once.
+func renderHTTPDConf(features []configFeature, locations []webServerLocation) string {
+	var modules []string
+	seen := map[string]bool{}
+	for _, feature := range features {
+		for _, module := range feature.Modules {
+			if !seen[module] {
+				seen[module] = true
+				modules = append(modules, fmt.Sprintf("LoadModule %s_module modules/mod_%s.so", module, module))
+			}
+		}
+	}
+
+	for _, feature := range features {
+		for _, file := range feature.ModuleFiles {
+			module := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "mod_"), ".so")
+			if !seen[module] {
+				seen[module] = true
+				modules = append(modules, fmt.Sprintf("LoadModule %s_module %q", module, file))
+			}
+		}
+	}
+
+	blocks := [][]string{
+		{`ServerRoot "${SERVER_ROOT}"`},
+		{`ServerName "0.0.0.0"`},
+		modules,
+	}
+
+	for _, feature := range features {
+		blocks = append(blocks, feature.Server...)
+	}
+
+	for _, location := range locations {
+		var rules [][]string
+
+		seen := map[string]bool{}
+		for _, feature := range features {
+			var block []string
+			if feature.DirectorySetup != nil {
+				for _, directive := range feature.DirectorySetup(location) {
+					if !seen[directive] {
+						seen[directive] = true
+						block = append(block, directive)
+					}
+				}
+			}
+
+			if feature.DirectoryRules != nil {
+				block = append(block, feature.DirectoryRules(location)...)
+			}
+
+			if len(block) > 0 {
+				rules = append(rules, block)
+			}
+		}
+
+		directory := []string{fmt.Sprintf("<Directory %q>", location.Root)}
+		for i, block := range rules {
+			if i > 0 {
+				directory = append(directory, "")
+			}
+			for _, directive := range block {
+				directory = append(directory, strings.TrimRight("  "+directive, " "))
+			}
+		}
+		directory = append(directory, "</Directory>")
+
+		blocks = append(blocks, directory)
+	}
+
+	for _, feature := range features {
+		blocks = append(blocks, feature.Final...)
+	}
+
+	var contents []string
+	written := map[string]bool{}
+	for _, block := range blocks {
+		text := strings.Join(block, "\n")
+		if len(block) == 0 || written[text] {
+			continue
+		}
+		written[text] = true
+
+		contents = append(contents, text)
+	}
+
+	return strings.Join(contents, "\n\n") + "\n"
+}
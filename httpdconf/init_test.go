@@ -0,0 +1,15 @@
+package httpdconf_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitHTTPDConf(t *testing.T) {
+	suite := spec.New("httpdconf", spec.Report(report.Terminal{}))
+	suite("Parser", testParser)
+	suite("Writer", testWriter)
+	suite.Run(t)
+}
@@ -0,0 +1,105 @@
+// Package httpdconf reads and writes Apache HTTP Server configuration files.
+package httpdconf
+
+import (
+	"regexp"
+	"strings"
+)
+
+// File is a parsed configuration file.
+type File struct {
+	Path  string
+	Nodes []*Node
+}
+
+// Node is a directive, a section or a comment line of a configuration file.
+// Sections, such as <Directory>, hold the nodes between their opening and
+// closing tags as Children. Include and IncludeOptional directives hold the
+// files that they resolved to as Includes.
+type Node struct {
+	Name     string
+	Args     []string
+	Comment  string
+	Section  bool
+	File     string
+	Line     int
+	Children []*Node
+	Includes []*File
+}
+
+// IsComment reports whether the node is a comment line.
+func (n *Node) IsComment() bool {
+	return n.Name == ""
+}
+
+// Is reports whether the node is a directive or section with the given name.
+// Like httpd, the comparison ignores case.
+func (n *Node) Is(name string) bool {
+	return n.Name != "" && strings.EqualFold(n.Name, name)
+}
+
+// Variables returns the names of the ${VAR} references in the arguments of
+// the node, in order of appearance.
+func (n *Node) Variables() []string {
+	var names []string
+	for _, arg := range n.Args {
+		names = append(names, References(arg)...)
+	}
+	return names
+}
+
+// Walk calls fn for every node in the file in order, descending into the
+// children of sections and the files pulled in by includes. The children of a
+// node are skipped when fn returns false.
+func (f *File) Walk(fn func(*Node) bool) {
+	walk(f.Nodes, fn)
+}
+
+func walk(nodes []*Node, fn func(*Node) bool) {
+	for _, node := range nodes {
+		if !fn(node) {
+			continue
+		}
+
+		walk(node.Children, fn)
+		for _, include := range node.Includes {
+			walk(include.Nodes, fn)
+		}
+	}
+}
+
+// Find returns every directive or section with the given name, including
+// those inside sections and included files.
+func (f *File) Find(name string) []*Node {
+	var nodes []*Node
+	f.Walk(func(node *Node) bool {
+		if node.Is(name) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+var variablePattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// References returns the names of the ${VAR} references in s.
+func References(s string) []string {
+	var names []string
+	for _, match := range variablePattern.FindAllStringSubmatch(s, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Expand replaces the ${VAR} references in s using lookup. References that
+// lookup does not know are left in place, as httpd does.
+func Expand(s string, lookup func(name string) (string, bool)) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(reference string) string {
+		value, ok := lookup(reference[2 : len(reference)-1])
+		if !ok {
+			return reference
+		}
+		return value
+	})
+}
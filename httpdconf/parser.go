@@ -0,0 +1,362 @@
+package httpdconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseError reports a problem at a line of a configuration file.
+type ParseError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Parser reads configuration files and the files that they include.
+type Parser struct {
+	serverRoot string
+	env        map[string]string
+}
+
+// NewParser returns a Parser that resolves relative Include paths against
+// serverRoot until a ServerRoot directive says otherwise, and that expands
+// ${VAR} references in Include and ServerRoot arguments from env and from
+// Define directives.
+func NewParser(serverRoot string, env map[string]string) Parser {
+	return Parser{
+		serverRoot: serverRoot,
+		env:        env,
+	}
+}
+
+// ParseFile parses the configuration file at path. The files pulled in by
+// Include and IncludeOptional directives are parsed as well and attached to
+// those directives.
+func (p Parser) ParseFile(path string) (*File, error) {
+	state := &parser{
+		serverRoot: p.serverRoot,
+		env:        p.env,
+		defines:    map[string]string{},
+		includes:   true,
+	}
+
+	return state.parseFile(path)
+}
+
+// Parse parses configuration read from r, reporting positions against the
+// given name. Include directives are kept but not resolved.
+func Parse(r io.Reader, name string) (*File, error) {
+	state := &parser{
+		defines: map[string]string{},
+	}
+
+	return state.parse(r, name)
+}
+
+type parser struct {
+	serverRoot string
+	env        map[string]string
+	defines    map[string]string
+	includes   bool
+	files      []string
+}
+
+type line struct {
+	text   string
+	number int
+}
+
+func (p *parser) parseFile(path string) (*File, error) {
+	for _, file := range p.files {
+		if file == path {
+			return nil, fmt.Errorf("failed to parse %s: file includes itself", path)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	defer file.Close()
+
+	p.files = append(p.files, path)
+	defer func() { p.files = p.files[:len(p.files)-1] }()
+
+	return p.parse(file, path)
+}
+
+func (p *parser) parse(r io.Reader, name string) (*File, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	file := &File{Path: name}
+
+	var sections []*Node
+	add := func(node *Node) {
+		if len(sections) > 0 {
+			parent := sections[len(sections)-1]
+			parent.Children = append(parent.Children, node)
+			return
+		}
+		file.Nodes = append(file.Nodes, node)
+	}
+
+	for _, l := range lines {
+		text := strings.TrimSpace(l.text)
+
+		switch {
+		case text == "":
+			continue
+
+		case strings.HasPrefix(text, "#"):
+			add(&Node{Comment: strings.TrimPrefix(text, "#"), File: name, Line: l.number})
+
+		case strings.HasPrefix(text, "</"):
+			if !strings.HasSuffix(text, ">") {
+				return nil, ParseError{name, l.number, fmt.Sprintf("closing tag %q is missing its '>'", text)}
+			}
+
+			tag := strings.TrimSpace(text[2 : len(text)-1])
+			if len(sections) == 0 {
+				return nil, ParseError{name, l.number, fmt.Sprintf("</%s> without matching <%s> section", tag, tag)}
+			}
+
+			section := sections[len(sections)-1]
+			if !section.Is(tag) {
+				return nil, ParseError{name, l.number, fmt.Sprintf("</%s> does not close <%s> opened on line %d", tag, section.Name, section.Line)}
+			}
+			sections = sections[:len(sections)-1]
+
+		case strings.HasPrefix(text, "<"):
+			if !strings.HasSuffix(text, ">") {
+				return nil, ParseError{name, l.number, fmt.Sprintf("section %q is missing its '>'", text)}
+			}
+
+			words := splitWords(text[1 : len(text)-1])
+			if len(words) == 0 {
+				return nil, ParseError{name, l.number, "section without a name"}
+			}
+
+			section := &Node{Name: words[0], Args: words[1:], Section: true, File: name, Line: l.number}
+			add(section)
+			sections = append(sections, section)
+
+		default:
+			words := splitWords(text)
+			node := &Node{Name: words[0], Args: words[1:], File: name, Line: l.number}
+			add(node)
+
+			err = p.apply(node)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(sections) > 0 {
+		section := sections[len(sections)-1]
+		return nil, ParseError{name, section.Line, fmt.Sprintf("<%s> section is never closed", section.Name)}
+	}
+
+	return file, nil
+}
+
+// apply tracks the directives that change how later Include paths are
+// resolved, and resolves the includes themselves.
+func (p *parser) apply(node *Node) error {
+	switch {
+	case node.Is("Define"):
+		if len(node.Args) == 2 {
+			p.defines[node.Args[0]] = p.expand(node.Args[1])
+		}
+
+	case node.Is("UnDefine"):
+		if len(node.Args) == 1 {
+			delete(p.defines, node.Args[0])
+		}
+
+	case node.Is("ServerRoot"):
+		if len(node.Args) == 1 {
+			p.serverRoot = p.expand(node.Args[0])
+		}
+
+	case node.Is("Include"), node.Is("IncludeOptional"):
+		if !p.includes {
+			return nil
+		}
+
+		files, err := p.include(node)
+		if err != nil {
+			return err
+		}
+		node.Includes = files
+	}
+
+	return nil
+}
+
+func (p *parser) include(node *Node) ([]*File, error) {
+	optional := node.Is("IncludeOptional")
+
+	if len(node.Args) != 1 {
+		return nil, ParseError{node.File, node.Line, fmt.Sprintf("%s takes exactly one argument", node.Name)}
+	}
+
+	pattern := p.expand(node.Args[0])
+	if names := References(pattern); len(names) > 0 {
+		if optional {
+			return nil, nil
+		}
+		return nil, ParseError{node.File, node.Line, fmt.Sprintf("%s path %q references undefined variable %q", node.Name, node.Args[0], names[0])}
+	}
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.serverRoot, pattern)
+	}
+
+	var paths []string
+	if strings.ContainsAny(pattern, `*?[`) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, ParseError{node.File, node.Line, fmt.Sprintf("%s pattern %q is invalid: %s", node.Name, pattern, err)}
+		}
+
+		if len(matches) == 0 && !optional {
+			return nil, ParseError{node.File, node.Line, fmt.Sprintf("%s pattern %q does not match any files", node.Name, pattern)}
+		}
+		paths = matches
+	} else {
+		_, err := os.Stat(pattern)
+		if err != nil {
+			if optional && os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, ParseError{node.File, node.Line, fmt.Sprintf("%s path %q cannot be read: %s", node.Name, pattern, err)}
+		}
+		paths = []string{pattern}
+	}
+
+	var files []*File
+	for _, path := range paths {
+		// A directory includes every file beneath it, in lexical order.
+		err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() {
+				return nil
+			}
+
+			file, err := p.parseFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, file)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func (p *parser) expand(s string) string {
+	return Expand(s, func(name string) (string, bool) {
+		if value, ok := p.defines[name]; ok {
+			return value, true
+		}
+		value, ok := p.env[name]
+		return value, ok
+	})
+}
+
+// readLines returns the lines of r with backslash continuations joined,
+// numbered by the line that they start on.
+func readLines(r io.Reader) ([]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	var (
+		lines   []line
+		current *line
+		number  int
+	)
+	for scanner.Scan() {
+		number++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if current == nil {
+			current = &line{number: number}
+		}
+
+		if strings.HasSuffix(text, `\`) {
+			current.text += strings.TrimSuffix(text, `\`)
+			continue
+		}
+
+		current.text += text
+		lines = append(lines, *current)
+		current = nil
+	}
+
+	if current != nil {
+		lines = append(lines, *current)
+	}
+
+	return lines, scanner.Err()
+}
+
+// splitWords splits a line into words the way httpd does: words are separated
+// by whitespace and may be wrapped in double or single quotes, inside of which
+// a backslash escapes the quote character.
+func splitWords(s string) []string {
+	var words []string
+
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		if s[i] == '"' || s[i] == '\'' {
+			quote := s[i]
+			i++
+
+			var word strings.Builder
+			for i < len(s) && s[i] != quote {
+				if s[i] == '\\' && i+1 < len(s) && s[i+1] == quote {
+					i++
+				}
+				word.WriteByte(s[i])
+				i++
+			}
+			i++
+
+			words = append(words, word.String())
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+		words = append(words, s[start:i])
+	}
+
+	return words
+}
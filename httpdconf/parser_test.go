@@ -0,0 +1,260 @@
+package httpdconf_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd/httpdconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testParser(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("Parse", func() {
+		it("parses directives, sections and comments with their line numbers", func() {
+			file, err := httpdconf.Parse(strings.NewReader(`# Server
+ServerRoot "${SERVER_ROOT}"
+Listen ${PORT}
+
+<Directory "${APP_ROOT}/public">
+  Require all granted
+  <IfModule rewrite_module>
+    RewriteEngine On
+  </ifmodule>
+</Directory>
+`), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Path).To(Equal("httpd.conf"))
+			Expect(file.Nodes).To(Equal([]*httpdconf.Node{
+				{Comment: " Server", File: "httpd.conf", Line: 1},
+				{Name: "ServerRoot", Args: []string{"${SERVER_ROOT}"}, File: "httpd.conf", Line: 2},
+				{Name: "Listen", Args: []string{"${PORT}"}, File: "httpd.conf", Line: 3},
+				{
+					Name:    "Directory",
+					Args:    []string{"${APP_ROOT}/public"},
+					Section: true,
+					File:    "httpd.conf",
+					Line:    5,
+					Children: []*httpdconf.Node{
+						{Name: "Require", Args: []string{"all", "granted"}, File: "httpd.conf", Line: 6},
+						{
+							Name:    "IfModule",
+							Args:    []string{"rewrite_module"},
+							Section: true,
+							File:    "httpd.conf",
+							Line:    7,
+							Children: []*httpdconf.Node{
+								{Name: "RewriteEngine", Args: []string{"On"}, File: "httpd.conf", Line: 8},
+							},
+						},
+					},
+				},
+			}))
+		})
+
+		it("splits arguments the way httpd does", func() {
+			file, err := httpdconf.Parse(strings.NewReader(`LogFormat "%h \"%r\" %>s" 'common log'  plain`+"\n"), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[0].Args).To(Equal([]string{`%h "%r" %>s`, "common log", "plain"}))
+		})
+
+		it("joins continued lines and numbers them by their first line", func() {
+			file, err := httpdconf.Parse(strings.NewReader("RewriteRule ^/old \\\n    /new [R=301]\nListen 8080\n"), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[0].Args).To(Equal([]string{"^/old", "/new", "[R=301]"}))
+			Expect(file.Nodes[0].Line).To(Equal(1))
+			Expect(file.Nodes[1].Line).To(Equal(3))
+		})
+
+		it("keeps include directives without resolving them", func() {
+			file, err := httpdconf.Parse(strings.NewReader("Include conf/missing.conf\n"), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[0].Is("include")).To(BeTrue())
+			Expect(file.Nodes[0].Includes).To(BeEmpty())
+		})
+
+		context("failure cases", func() {
+			context("when a section is closed by the wrong tag", func() {
+				it("returns an error with the position", func() {
+					_, err := httpdconf.Parse(strings.NewReader("<Directory />\n</Location>\n"), "httpd.conf")
+					Expect(err).To(MatchError("httpd.conf:2: </Location> does not close <Directory> opened on line 1"))
+					Expect(err).To(BeAssignableToTypeOf(httpdconf.ParseError{}))
+				})
+			})
+
+			context("when a section is never closed", func() {
+				it("returns an error with the position", func() {
+					_, err := httpdconf.Parse(strings.NewReader("Listen 80\n<Directory />\n  Require all denied\n"), "httpd.conf")
+					Expect(err).To(MatchError("httpd.conf:2: <Directory> section is never closed"))
+				})
+			})
+
+			context("when a section is closed without being opened", func() {
+				it("returns an error with the position", func() {
+					_, err := httpdconf.Parse(strings.NewReader("</Directory>\n"), "httpd.conf")
+					Expect(err).To(MatchError("httpd.conf:1: </Directory> without matching <Directory> section"))
+				})
+			})
+
+			context("when a section is missing its '>'", func() {
+				it("returns an error with the position", func() {
+					_, err := httpdconf.Parse(strings.NewReader("<Directory /\n"), "httpd.conf")
+					Expect(err).To(MatchError(`httpd.conf:1: section "<Directory /" is missing its '>'`))
+				})
+			})
+		})
+	})
+
+	context("ParseFile", func() {
+		var serverRoot string
+
+		it.Before(func() {
+			var err error
+			serverRoot, err = os.MkdirTemp("", "server-root")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(serverRoot, "conf", "extra"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(serverRoot, "conf", "extra", "b.conf"), []byte("Header set B b\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(serverRoot, "conf", "extra", "a.conf"), []byte("\n\nHeader set A a\n"), 0600)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(serverRoot)).To(Succeed())
+		})
+
+		it("resolves includes against the server root", func() {
+			path := filepath.Join(serverRoot, "conf", "httpd.conf")
+			Expect(os.WriteFile(path, []byte("Include conf/extra/*.conf\nIncludeOptional conf/missing/*.conf\n"), 0600)).To(Succeed())
+
+			file, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[0].Includes).To(Equal([]*httpdconf.File{
+				{
+					Path: filepath.Join(serverRoot, "conf", "extra", "a.conf"),
+					Nodes: []*httpdconf.Node{
+						{Name: "Header", Args: []string{"set", "A", "a"}, File: filepath.Join(serverRoot, "conf", "extra", "a.conf"), Line: 3},
+					},
+				},
+				{
+					Path: filepath.Join(serverRoot, "conf", "extra", "b.conf"),
+					Nodes: []*httpdconf.Node{
+						{Name: "Header", Args: []string{"set", "B", "b"}, File: filepath.Join(serverRoot, "conf", "extra", "b.conf"), Line: 1},
+					},
+				},
+			}))
+			Expect(file.Nodes[1].Includes).To(BeEmpty())
+
+			var names []string
+			for _, node := range file.Find("header") {
+				names = append(names, node.Args[1])
+			}
+			Expect(names).To(Equal([]string{"A", "B"}))
+		})
+
+		it("expands variables from the environment, Define and ServerRoot", func() {
+			path := filepath.Join(serverRoot, "httpd.conf")
+			Expect(os.WriteFile(path, []byte(`ServerRoot "${SERVER_ROOT}/conf"
+Define extra ${EXTRA}
+Include ${extra}
+Include extra/b.conf
+`), 0600)).To(Succeed())
+
+			file, err := httpdconf.NewParser("", map[string]string{
+				"SERVER_ROOT": serverRoot,
+				"EXTRA":       filepath.Join(serverRoot, "conf", "extra", "a.conf"),
+			}).ParseFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[2].Variables()).To(Equal([]string{"extra"}))
+			Expect(file.Nodes[2].Includes[0].Path).To(Equal(filepath.Join(serverRoot, "conf", "extra", "a.conf")))
+			Expect(file.Nodes[3].Includes[0].Path).To(Equal(filepath.Join(serverRoot, "conf", "extra", "b.conf")))
+		})
+
+		it("includes every file in an included directory", func() {
+			path := filepath.Join(serverRoot, "httpd.conf")
+			Expect(os.WriteFile(path, []byte("Include conf\n"), 0600)).To(Succeed())
+
+			file, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(file.Nodes[0].Includes).To(HaveLen(2))
+		})
+
+		context("failure cases", func() {
+			context("when an included file does not exist", func() {
+				it("returns an error with the position of the include", func() {
+					path := filepath.Join(serverRoot, "httpd.conf")
+					Expect(os.WriteFile(path, []byte("Listen 80\nInclude conf/missing.conf\n"), 0600)).To(Succeed())
+
+					_, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+					Expect(err).To(MatchError(ContainSubstring(path + `:2: Include path "` + filepath.Join(serverRoot, "conf", "missing.conf") + `" cannot be read`)))
+				})
+			})
+
+			context("when an include pattern does not match any files", func() {
+				it("returns an error", func() {
+					path := filepath.Join(serverRoot, "httpd.conf")
+					Expect(os.WriteFile(path, []byte("Include conf/*.load\n"), 0600)).To(Succeed())
+
+					_, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+					Expect(err).To(MatchError(ContainSubstring("does not match any files")))
+				})
+			})
+
+			context("when an include path references an undefined variable", func() {
+				it("returns an error", func() {
+					path := filepath.Join(serverRoot, "httpd.conf")
+					Expect(os.WriteFile(path, []byte("Include ${CONF_DIR}/*.conf\n"), 0600)).To(Succeed())
+
+					_, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+					Expect(err).To(MatchError(path + `:1: Include path "${CONF_DIR}/*.conf" references undefined variable "CONF_DIR"`))
+				})
+			})
+
+			context("when a file includes itself", func() {
+				it("returns an error", func() {
+					path := filepath.Join(serverRoot, "httpd.conf")
+					Expect(os.WriteFile(path, []byte("Include httpd.conf\n"), 0600)).To(Succeed())
+
+					_, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+					Expect(err).To(MatchError(ContainSubstring("file includes itself")))
+				})
+			})
+
+			context("when an included file cannot be parsed", func() {
+				it("returns an error with the position in that file", func() {
+					Expect(os.WriteFile(filepath.Join(serverRoot, "conf", "extra", "b.conf"), []byte("<Location />\n"), 0600)).To(Succeed())
+
+					path := filepath.Join(serverRoot, "httpd.conf")
+					Expect(os.WriteFile(path, []byte("Include conf/extra/*.conf\n"), 0600)).To(Succeed())
+
+					_, err := httpdconf.NewParser(serverRoot, nil).ParseFile(path)
+					Expect(err).To(MatchError(filepath.Join(serverRoot, "conf", "extra", "b.conf") + ":1: <Location> section is never closed"))
+				})
+			})
+		})
+	})
+
+	context("Expand", func() {
+		it("replaces known references and keeps unknown ones", func() {
+			expanded := httpdconf.Expand("${APP_ROOT}/${DIR}", func(name string) (string, bool) {
+				if name == "APP_ROOT" {
+					return "/workspace", true
+				}
+				return "", false
+			})
+			Expect(expanded).To(Equal("/workspace/${DIR}"))
+			Expect(httpdconf.References("${APP_ROOT}/${DIR}")).To(Equal([]string{"APP_ROOT", "DIR"}))
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package httpdconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Write writes the given nodes in httpd.conf syntax, indenting the children of
+// sections by two spaces per level. The files pulled in by includes are not
+// written, only the directives that include them.
+func Write(w io.Writer, nodes []*Node) error {
+	return write(w, nodes, 0)
+}
+
+func write(w io.Writer, nodes []*Node, depth int) error {
+	indent := strings.Repeat("  ", depth)
+
+	for _, node := range nodes {
+		var err error
+		switch {
+		case node.IsComment():
+			_, err = fmt.Fprintf(w, "%s#%s\n", indent, node.Comment)
+
+		case node.Section:
+			_, err = fmt.Fprintf(w, "%s<%s>\n", indent, directive(node))
+			if err != nil {
+				return err
+			}
+
+			err = write(w, node.Children, depth+1)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(w, "%s</%s>\n", indent, node.Name)
+
+		default:
+			_, err = fmt.Fprintf(w, "%s%s\n", indent, directive(node))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String returns the contents of the file in httpd.conf syntax.
+func (f *File) String() string {
+	buffer := bytes.NewBuffer(nil)
+	_ = Write(buffer, f.Nodes)
+	return buffer.String()
+}
+
+func directive(node *Node) string {
+	words := []string{node.Name}
+	for _, arg := range node.Args {
+		words = append(words, Quote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// Quote returns arg as a single httpd.conf word, wrapping it in double quotes
+// when it would otherwise be split or misread.
+func Quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'<>") {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
@@ -0,0 +1,69 @@
+package httpdconf_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd/httpdconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testWriter(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("Write", func() {
+		it("writes the nodes back out in httpd.conf syntax", func() {
+			file, err := httpdconf.Parse(strings.NewReader(`# Server
+ServerRoot "${SERVER_ROOT}"
+LogFormat "%h \"%r\"" common
+
+<Directory "/srv/my site">
+    Require all granted
+  <IfModule rewrite_module>
+RewriteRule ^ - [L]
+  </IfModule>
+</Directory>
+Include conf.d/*.conf
+`), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+
+			buffer := bytes.NewBuffer(nil)
+			Expect(httpdconf.Write(buffer, file.Nodes)).To(Succeed())
+			Expect(buffer.String()).To(Equal(`# Server
+ServerRoot ${SERVER_ROOT}
+LogFormat "%h \"%r\"" common
+<Directory "/srv/my site">
+  Require all granted
+  <IfModule rewrite_module>
+    RewriteRule ^ - [L]
+  </IfModule>
+</Directory>
+Include conf.d/*.conf
+`))
+
+			reparsed, err := httpdconf.Parse(strings.NewReader(buffer.String()), "httpd.conf")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reparsed.String()).To(Equal(buffer.String()))
+		})
+
+		it("writes nodes that were built in code", func() {
+			file := &httpdconf.File{
+				Nodes: []*httpdconf.Node{
+					{Name: "Listen", Args: []string{"${PORT}"}},
+					{Name: "Location", Args: []string{"/a>b"}, Section: true, Children: []*httpdconf.Node{
+						{Name: "Header", Args: []string{"set", "X-Empty", ""}},
+					}},
+				},
+			}
+
+			Expect(file.String()).To(Equal(`Listen ${PORT}
+<Location "/a>b">
+  Header set X-Empty ""
+</Location>
+`))
+		})
+	})
+}
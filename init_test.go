@@ -10,7 +10,10 @@ import (
 func TestUnitHTTPD(t *testing.T) {
 	suite := spec.New("httpd", spec.Report(report.Terminal{}))
 	suite("Build", testBuild)
+	suite("BuildHTTPDModule", testBuildHTTPDModule)
+	suite("CheckHTTPDConfig", testCheckHTTPDConfig)
 	suite("Detect", testDetect)
+	suite("FindModuleSources", testFindModuleSources)
 	suite("GenerateHTTPDConfig", testGenerateHTTPDConfig)
 	suite("VersionParser", testVersionParser)
 	suite.Run(t)
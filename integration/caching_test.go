@@ -74,12 +74,23 @@ func testCaching(t *testing.T, when spec.G, it spec.S) {
 			MatchRegexp(`    Installing Apache HTTP Server \d+\.\d+\.\d+`),
 			MatchRegexp(`      Completed in (\d+\.\d+|\d{3})`),
 			"",
+			"  Configuring build environment",
+			fmt.Sprintf(`    APR_INCLUDE_DIR -> "/layers/%s/httpd/include"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    HTTPD_CONF_D    -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    PATH            -> "/layers/%s/httpd/bin:$PATH"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    SERVER_ROOT     -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			"",
 			"  Configuring launch environment",
-			`    APP_ROOT    -> "/workspace"`,
-			fmt.Sprintf(`    SERVER_ROOT -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			`    APP_ROOT                      -> "/workspace"`,
+			`    BPL_HTTPD_MAX_REQUEST_WORKERS -> "auto"`,
+			`    BPL_HTTPD_THREADS_PER_CHILD   -> "auto"`,
+			fmt.Sprintf(`    HTTPD_CONF_D                  -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			`    HTTPD_MPM                     -> "event"`,
+			`    HTTPD_RUNTIME_DIR             -> "/tmp"`,
+			fmt.Sprintf(`    SERVER_ROOT                   -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 			"",
 			"  Assigning launch processes:",
-			"    web (default): httpd -f /workspace/httpd.conf -k start -DFOREGROUND",
+			fmt.Sprintf("    web (default): /layers/%s/httpd/bin/start-httpd httpd -f /workspace/httpd.conf -k start -DFOREGROUND", strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 		))
 
 		imageIDs[firstImage.ID] = struct{}{}
@@ -113,7 +124,7 @@ func testCaching(t *testing.T, when spec.G, it spec.S) {
 			fmt.Sprintf("  Reusing cached layer /layers/%s/httpd", strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 			"",
 			"  Assigning launch processes:",
-			"    web (default): httpd -f /workspace/httpd.conf -k start -DFOREGROUND",
+			fmt.Sprintf("    web (default): /layers/%s/httpd/bin/start-httpd httpd -f /workspace/httpd.conf -k start -DFOREGROUND", strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 		))
 
 		imageIDs[secondImage.ID] = struct{}{}
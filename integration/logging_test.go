@@ -71,9 +71,20 @@ func testLogging(t *testing.T, context spec.G, it spec.S) {
 			MatchRegexp(`    Installing Apache HTTP Server \d+\.\d+\.\d+`),
 			MatchRegexp(`      Completed in (\d+\.\d+|\d{3})`),
 			"",
+			"  Configuring build environment",
+			fmt.Sprintf(`    APR_INCLUDE_DIR -> "/layers/%s/httpd/include"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    HTTPD_CONF_D    -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    PATH            -> "/layers/%s/httpd/bin:$PATH"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			fmt.Sprintf(`    SERVER_ROOT     -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			"",
 			"  Configuring launch environment",
-			`    APP_ROOT    -> "/workspace"`,
-			fmt.Sprintf(`    SERVER_ROOT -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			`    APP_ROOT                      -> "/workspace"`,
+			`    BPL_HTTPD_MAX_REQUEST_WORKERS -> "auto"`,
+			`    BPL_HTTPD_THREADS_PER_CHILD   -> "auto"`,
+			fmt.Sprintf(`    HTTPD_CONF_D                  -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+			`    HTTPD_MPM                     -> "event"`,
+			`    HTTPD_RUNTIME_DIR             -> "/tmp"`,
+			fmt.Sprintf(`    SERVER_ROOT                   -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 		))
 	})
 
@@ -110,9 +121,20 @@ func testLogging(t *testing.T, context spec.G, it spec.S) {
 				MatchRegexp(`    Installing Apache HTTP Server \d+\.\d+\.\d+`),
 				MatchRegexp(`      Completed in (\d+\.\d+|\d{3})`),
 				"",
+				"  Configuring build environment",
+				fmt.Sprintf(`    APR_INCLUDE_DIR -> "/layers/%s/httpd/include"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				fmt.Sprintf(`    HTTPD_CONF_D    -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				fmt.Sprintf(`    PATH            -> "/layers/%s/httpd/bin:$PATH"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				fmt.Sprintf(`    SERVER_ROOT     -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				"",
 				"  Configuring launch environment",
-				`    APP_ROOT    -> "/workspace"`,
-				fmt.Sprintf(`    SERVER_ROOT -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				`    APP_ROOT                      -> "/workspace"`,
+				`    BPL_HTTPD_MAX_REQUEST_WORKERS -> "auto"`,
+				`    BPL_HTTPD_THREADS_PER_CHILD   -> "auto"`,
+				fmt.Sprintf(`    HTTPD_CONF_D                  -> "/layers/%s/httpd/conf.d"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
+				`    HTTPD_MPM                     -> "event"`,
+				`    HTTPD_RUNTIME_DIR             -> "/tmp"`,
+				fmt.Sprintf(`    SERVER_ROOT                   -> "/layers/%s/httpd"`, strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_")),
 			))
 
 		})
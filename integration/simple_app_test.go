@@ -136,8 +136,9 @@ func testSimpleApp(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(logs).To(ContainLines("  Assigning launch processes:"))
-			Expect(logs).To(ContainLines("    web (default): watchexec --restart --watch /workspace --shell none -- httpd -f /workspace/httpd.conf -k start -DFOREGROUND"))
-			Expect(logs).To(ContainLines("    no-reload:     httpd -f /workspace/httpd.conf -k start -DFOREGROUND"))
+			startHTTPD := fmt.Sprintf("/layers/%s/httpd/bin/start-httpd", strings.ReplaceAll(buildpackInfo.Buildpack.ID, "/", "_"))
+			Expect(logs).To(ContainLines(fmt.Sprintf("    web (default): watchexec --signal SIGUSR1 --watch /workspace --filter **/*.conf --filter **/_redirects --filter **/_headers --shell none -- %s httpd -f /workspace/httpd.conf -k start -DFOREGROUND", startHTTPD)))
+			Expect(logs).To(ContainLines(fmt.Sprintf("    no-reload:     %s httpd -f /workspace/httpd.conf -k start -DFOREGROUND", startHTTPD)))
 		})
 	})
 }
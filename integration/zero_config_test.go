@@ -1,15 +1,18 @@
 package integration_test
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/paketo-buildpacks/occam"
 	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -69,6 +72,7 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 
 			Expect(logs).To(ContainLines(
 				"  Generating httpd.conf",
+				"    Detected web server root '${APP_ROOT}/public'",
 				"",
 			))
 
@@ -82,6 +86,44 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 			Eventually(container).Should(Serve(ContainSubstring("Hello World!")).OnPort(8080))
 		})
 
+		context("when the container runs as an arbitrary user with a read-only root filesystem", func() {
+			it("serves a static site", func() {
+				var err error
+				image, _, err = pack.Build.
+					WithPullPolicy("never").
+					WithBuildpacks(httpdBuildpack).
+					WithEnv(map[string]string{
+						"BP_WEB_SERVER": "httpd",
+					}).
+					Execute(name, source)
+				Expect(err).NotTo(HaveOccurred())
+
+				// occam does not support these run options, so the container is
+				// started with the docker CLI directly.
+				stdout := bytes.NewBuffer(nil)
+				err = pexec.NewExecutable("docker").Execute(pexec.Execution{
+					Args: []string{
+						"container", "run",
+						"--detach",
+						"--user", "1000680000:0",
+						"--read-only",
+						"--tmpfs", "/tmp",
+						"--env", "PORT=8080",
+						"--publish", "8080",
+						image.ID,
+					},
+					Stdout: stdout,
+					Stderr: stdout,
+				})
+				Expect(err).NotTo(HaveOccurred(), stdout.String())
+
+				container, err = docker.Container.Inspect.Execute(strings.TrimSpace(stdout.String()))
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(container).Should(Serve(ContainSubstring("Hello World!")).OnPort(8080))
+			})
+		})
+
 		context("when the static directory is configured to something other than public", func() {
 			it.Before(func() {
 				Expect(fs.Move(filepath.Join(source, "public"), filepath.Join(source, "htdocs"))).To(Succeed())
@@ -137,6 +179,7 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 
 				Expect(logs).To(ContainLines(
 					"  Generating httpd.conf",
+					"    Detected web server root '${APP_ROOT}/public'",
 					"    Adds configuration that enables push state",
 					"",
 				))
@@ -152,6 +195,51 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the user sets a base path", func() {
+			it("serves a static site under that prefix", func() {
+				var (
+					err  error
+					logs fmt.Stringer
+				)
+				image, logs, err = pack.Build.
+					WithPullPolicy("never").
+					WithBuildpacks(httpdBuildpack).
+					WithEnv(map[string]string{
+						"BP_WEB_SERVER":           "httpd",
+						"BP_WEB_SERVER_BASE_PATH": "/docs",
+					}).
+					Execute(name, source)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logs).To(ContainLines(
+					"  Generating httpd.conf",
+					"    Adds configuration to serve web server root under base path '/docs'",
+					"    Detected web server root '${APP_ROOT}/public'",
+					"",
+				))
+
+				container, err = docker.Container.Run.
+					WithEnv(map[string]string{"PORT": "8080"}).
+					WithPublish("8080").
+					WithPublishAll().
+					Execute(image.ID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(container).Should(Serve(ContainSubstring("Hello World!")).OnPort(8080).WithEndpoint("/docs/"))
+
+				client := &http.Client{
+					CheckRedirect: func(req *http.Request, via []*http.Request) error {
+						return http.ErrUseLastResponse
+					},
+				}
+
+				response, err := client.Get(fmt.Sprintf("http://localhost:%s/docs", container.HostPort("8080")))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response.StatusCode).To(Equal(http.StatusMovedPermanently))
+				Expect(response.Header.Get("Location")).To(HaveSuffix("/docs/"))
+			})
+		})
+
 		context("when the user sets https forced redirect", func() {
 			it("serves a static site that always redirects to https", func() {
 				var (
@@ -170,6 +258,7 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 
 				Expect(logs).To(ContainLines(
 					"  Generating httpd.conf",
+					"    Detected web server root '${APP_ROOT}/public'",
 					"    Adds configuration that forces https redirect",
 					"",
 				))
@@ -198,6 +287,47 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("app with several build outputs", func() {
+		it.Before(func() {
+			var err error
+			source, err = occam.Source(filepath.Join("testdata", "zero_config_locations"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("serves each build output from its own path", func() {
+			var (
+				err  error
+				logs fmt.Stringer
+			)
+			image, logs, err = pack.Build.
+				WithPullPolicy("never").
+				WithBuildpacks(httpdBuildpack).
+				WithEnv(map[string]string{
+					"BP_WEB_SERVER":           "httpd",
+					"BP_WEB_SERVER_LOCATIONS": "/=apps/web/dist:push-state,/docs=apps/docs/build",
+				}).
+				Execute(name, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logs).To(ContainLines(
+				"  Generating httpd.conf",
+				"    Adds configuration to serve '${APP_ROOT}/apps/web/dist' at '/'",
+				"    Adds configuration to serve '${APP_ROOT}/apps/docs/build' at '/docs/'",
+				"",
+			))
+
+			container, err = docker.Container.Run.
+				WithEnv(map[string]string{"PORT": "8080"}).
+				WithPublish("8080").
+				WithPublishAll().
+				Execute(image.ID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(container).Should(Serve(ContainSubstring("Hello from web!")).OnPort(8080).WithEndpoint("/some/route"))
+			Eventually(container).Should(Serve(ContainSubstring("Hello from docs!")).OnPort(8080).WithEndpoint("/docs/"))
+		})
+	})
+
 	context("app with binding", func() {
 		it.Before(func() {
 			var err error
@@ -223,6 +353,7 @@ func testZeroConfig(t *testing.T, context spec.G, it spec.S) {
 
 			Expect(logs).To(ContainLines(
 				"  Generating httpd.conf",
+				"    Detected web server root '${APP_ROOT}/public'",
 				"    Adds configuration that configured basic authentication from service binding",
 				"",
 			))
@@ -0,0 +1,115 @@
+package httpd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/httpd/httpdconf"
+	"github.com/paketo-buildpacks/packit/v2/fs"
+)
+
+// diagnostic is a problem found in a configuration file that would keep the
+// server from working as expected in a container.
+type diagnostic struct {
+	File    string
+	Line    int
+	Error   bool
+	Message string
+}
+
+func (d diagnostic) String() string {
+	severity := "warning"
+	if d.Error {
+		severity = "error"
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, severity, d.Message)
+}
+
+// logTargets are the log destinations that the platform collects.
+var logTargets = []string{"/proc/self/fd/1", "/proc/self/fd/2", "/dev/stdout", "/dev/stderr", "|", "syslog"}
+
+// lintHTTPDConfig checks the given configuration against what the
+// buildpack provides at launch: the port in $PORT, the modules of the
+// installed server at serverRoot and logs collected from stdout and stderr.
+// The file positions are reported relative to appRoot where possible.
+func lintHTTPDConfig(file *httpdconf.File, appRoot, serverRoot string, env map[string]string) ([]diagnostic, error) {
+	var (
+		diagnostics []diagnostic
+		err         error
+	)
+
+	report := func(node *httpdconf.Node, isError bool, format string, args ...interface{}) {
+		path := node.File
+		if rel, err := filepath.Rel(appRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			File:    path,
+			Line:    node.Line,
+			Error:   isError,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	file.Walk(func(node *httpdconf.Node) bool {
+		if err != nil {
+			return false
+		}
+
+		if len(node.Args) == 0 {
+			return true
+		}
+
+		switch {
+		case node.Is("Listen"):
+			if !strings.Contains(node.Args[0], "${PORT}") {
+				report(node, false, "Listen %s does not use ${PORT}, so the server will not receive the traffic that the platform sends to $PORT", node.Args[0])
+			}
+
+		case node.Is("LoadModule"):
+			if len(node.Args) != 2 {
+				break
+			}
+
+			path := httpdconf.Expand(node.Args[1], func(name string) (string, bool) {
+				value, ok := env[name]
+				return value, ok
+			})
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(serverRoot, path)
+			}
+
+			var exists bool
+			exists, err = fs.Exists(path)
+			if err == nil && !exists {
+				report(node, true, "LoadModule %s refers to %s, which the installed Apache HTTP Server does not provide", node.Args[0], node.Args[1])
+			}
+
+		case node.Is("ErrorLog"), node.Is("CustomLog"), node.Is("TransferLog"), node.Is("GlobalLog"):
+			for _, target := range logTargets {
+				if strings.HasPrefix(node.Args[0], target) {
+					return true
+				}
+			}
+			report(node, false, "%s writes to %s, use /proc/self/fd/1 (stdout) or /proc/self/fd/2 (stderr) so that the platform collects the logs", node.Name, node.Args[0])
+
+		case node.Is("ServerRoot"):
+			if strings.TrimSuffix(node.Args[0], "/") != "${SERVER_ROOT}" {
+				report(node, false, "ServerRoot %s does not point at ${SERVER_ROOT}, where the buildpack installs Apache HTTP Server", node.Args[0])
+			}
+
+		case node.Is("User"), node.Is("Group"):
+			if len(httpdconf.References(node.Args[0])) == 0 {
+				report(node, false, "%s %s only takes effect when the server starts as root and may not exist in the run image, use ${HTTPD_USER} for User and remove Group", node.Name, node.Args[0])
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return diagnostics, nil
+}
@@ -0,0 +1,87 @@
+package httpd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the values that are masked in the access log.
+const RedactedValue = "REDACTED"
+
+var queryParamPattern = regexp.MustCompile(`^[^\s"&=#?%\\]+$`)
+
+// logRedaction lists the query parameters and the request headers whose
+// values are masked in the access log.
+type logRedaction struct {
+	QueryParams []string
+	Headers     []string
+}
+
+func (r logRedaction) enabled() bool {
+	return len(r.QueryParams) > 0 || len(r.Headers) > 0
+}
+
+// masks reports whether the value of the given request header is masked.
+func (r logRedaction) masks(header string) bool {
+	for _, name := range r.Headers {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLogRedaction reads the comma separated lists of
+// BP_WEB_SERVER_LOG_REDACT_QUERY_PARAMS and BP_WEB_SERVER_LOG_REDACT_HEADERS.
+// Only the headers that the access log records can be masked, and they are
+// matched without regard to case.
+func parseLogRedaction(params, headers string) (logRedaction, error) {
+	var redaction logRedaction
+
+	for _, param := range strings.Split(params, ",") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+
+		if !queryParamPattern.MatchString(param) {
+			return logRedaction{}, fmt.Errorf("failed: BP_WEB_SERVER_LOG_REDACT_QUERY_PARAMS must be a comma separated list of query parameter names, got '%s'", param)
+		}
+		redaction.QueryParams = append(redaction.QueryParams, param)
+	}
+
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+
+		var name string
+		for _, logged := range redactedLogHeaders {
+			if strings.EqualFold(logged, header) {
+				name = logged
+			}
+		}
+
+		if name == "" {
+			return logRedaction{}, fmt.Errorf("failed: BP_WEB_SERVER_LOG_REDACT_HEADERS can only contain the headers that the access log records, '%s', got '%s'", strings.Join(redactedLogHeaders, "', '"), header)
+		}
+		redaction.Headers = append(redaction.Headers, name)
+	}
+
+	return redaction, nil
+}
+
+// queryParamsRegexp matches a query string, or a URL with a query string,
+// that contains one of the given parameters with a value that has not been
+// masked yet. The first group holds everything up to the value and the second
+// group everything after it.
+func queryParamsRegexp(params []string) string {
+	names := make([]string, 0, len(params))
+	for _, param := range params {
+		names = append(names, regexp.QuoteMeta(param))
+	}
+
+	return fmt.Sprintf(`^(.*(?:^|[?&])(?:%s)=)(?!%s(?:[&#]|$))[^&#]*(.*)$`, strings.Join(names, "|"), RedactedValue)
+}
@@ -0,0 +1,134 @@
+package httpd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/packit/v2/fs"
+)
+
+// ModuleSourcesDir is the directory of the app that holds the sources of the
+// out-of-tree modules to build.
+const ModuleSourcesDir = "modules-src"
+
+// ModuleSource is an out-of-tree module that is built from sources that are
+// part of the app, either a directory of C files or a vendored archive.
+type ModuleSource struct {
+	// Name is the name of the module without the mod_ prefix, so the module
+	// is built as mod_<name>.so and loaded as <name>_module.
+	Name    string
+	Version string
+
+	// Path is the directory or the archive that holds the sources.
+	Path    string
+	Archive bool
+
+	// SHA256 is the checksum of the sources, which changes whenever the
+	// module needs to be rebuilt.
+	SHA256 string
+}
+
+// moduleSourcesFile lists the vendored archives in modules-src/modules.toml.
+type moduleSourcesFile struct {
+	Modules []struct {
+		Name    string `toml:"name"`
+		Version string `toml:"version"`
+		Archive string `toml:"archive"`
+		SHA256  string `toml:"sha256"`
+	} `toml:"modules"`
+}
+
+// FindModuleSources returns the modules to build from the modules-src
+// directory of the app. Every directory in it holds the sources of the module
+// that it is named after, with an optional VERSION file, and the
+// modules.toml file lists vendored archives of module sources. The sources
+// are never downloaded, so archives need to be part of the app.
+func FindModuleSources(workingDir string) ([]ModuleSource, error) {
+	dir := filepath.Join(workingDir, ModuleSourcesDir)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []ModuleSource
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		source := ModuleSource{
+			Name: strings.TrimPrefix(entry.Name(), "mod_"),
+			Path: path,
+		}
+
+		version, err := os.ReadFile(filepath.Join(path, "VERSION"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		source.Version = strings.TrimSpace(string(version))
+
+		source.SHA256, err = fs.NewChecksumCalculator().Sum(path)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source)
+	}
+
+	var file moduleSourcesFile
+	_, err = toml.DecodeFile(filepath.Join(dir, "modules.toml"), &file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse %s/modules.toml: %w", ModuleSourcesDir, err)
+	}
+
+	for _, module := range file.Modules {
+		if module.Name == "" || module.Archive == "" {
+			return nil, fmt.Errorf("failed: every module in %s/modules.toml needs a name and an archive", ModuleSourcesDir)
+		}
+
+		if strings.Contains(module.Archive, "://") {
+			return nil, fmt.Errorf("failed: the archive of module '%s' must be a path in the app, module sources are not downloaded: '%s'", module.Name, module.Archive)
+		}
+
+		path := module.Archive
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workingDir, path)
+		}
+
+		sum, err := fs.NewChecksumCalculator().Sum(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the archive of module '%s': %w", module.Name, err)
+		}
+
+		if module.SHA256 != "" && !strings.EqualFold(module.SHA256, sum) {
+			return nil, fmt.Errorf("failed: the archive of module '%s' has checksum '%s', expected '%s'", module.Name, sum, module.SHA256)
+		}
+
+		sources = append(sources, ModuleSource{
+			Name:    strings.TrimPrefix(module.Name, "mod_"),
+			Version: module.Version,
+			Path:    path,
+			Archive: true,
+			SHA256:  sum,
+		})
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+
+	for i := 1; i < len(sources); i++ {
+		if sources[i].Name == sources[i-1].Name {
+			return nil, fmt.Errorf("failed: the sources of module '%s' are given more than once in %s", sources[i].Name, ModuleSourcesDir)
+		}
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,162 @@
+package httpd_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/httpd"
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testFindModuleSources(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("when the app has no module sources", func() {
+		it("returns no modules", func() {
+			sources, err := httpd.FindModuleSources(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sources).To(BeEmpty())
+		})
+	})
+
+	context("when the app has module sources", func() {
+		var archiveSHA, directorySHA string
+
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "modules-src", "mod_hello"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "mod_hello", "mod_hello.c"), []byte("/* hello */"), 0644)).To(Succeed())
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, "vendor"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "vendor", "mod_example-2.1.0.tar.gz"), []byte("some-archive"), 0644)).To(Succeed())
+
+			var err error
+			directorySHA, err = fs.NewChecksumCalculator().Sum(filepath.Join(workingDir, "modules-src", "mod_hello"))
+			Expect(err).NotTo(HaveOccurred())
+
+			archiveSHA, err = fs.NewChecksumCalculator().Sum(filepath.Join(workingDir, "vendor", "mod_example-2.1.0.tar.gz"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte(`[[modules]]
+name = "mod_example"
+version = "2.1.0"
+archive = "vendor/mod_example-2.1.0.tar.gz"
+sha256 = "`+archiveSHA+`"
+`), 0644)).To(Succeed())
+		})
+
+		it("returns the directories and the vendored archives in the order of their names", func() {
+			sources, err := httpd.FindModuleSources(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sources).To(Equal([]httpd.ModuleSource{
+				{
+					Name:    "example",
+					Version: "2.1.0",
+					Path:    filepath.Join(workingDir, "vendor", "mod_example-2.1.0.tar.gz"),
+					Archive: true,
+					SHA256:  archiveSHA,
+				},
+				{
+					Name:   "hello",
+					Path:   filepath.Join(workingDir, "modules-src", "mod_hello"),
+					SHA256: directorySHA,
+				},
+			}))
+		})
+	})
+
+	context("failure cases", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "modules-src"), os.ModePerm)).To(Succeed())
+		})
+
+		context("when the archive is given as a URL", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte(`[[modules]]
+name = "example"
+archive = "https://example.com/mod_example.tar.gz"
+`), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := httpd.FindModuleSources(workingDir)
+				Expect(err).To(MatchError("failed: the archive of module 'example' must be a path in the app, module sources are not downloaded: 'https://example.com/mod_example.tar.gz'"))
+			})
+		})
+
+		context("when the archive does not match its checksum", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "mod_example.tar.gz"), []byte("some-archive"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte(`[[modules]]
+name = "example"
+archive = "mod_example.tar.gz"
+sha256 = "some-other-sha"
+`), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := httpd.FindModuleSources(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed: the archive of module 'example' has checksum")))
+				Expect(err).To(MatchError(ContainSubstring("expected 'some-other-sha'")))
+			})
+		})
+
+		context("when the archive does not exist", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte(`[[modules]]
+name = "example"
+archive = "mod_example.tar.gz"
+`), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := httpd.FindModuleSources(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed to read the archive of module 'example'")))
+			})
+		})
+
+		context("when a module is given more than once", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "modules-src", "example"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "mod_example.tar.gz"), []byte("some-archive"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte(`[[modules]]
+name = "example"
+archive = "mod_example.tar.gz"
+`), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := httpd.FindModuleSources(workingDir)
+				Expect(err).To(MatchError("failed: the sources of module 'example' are given more than once in modules-src"))
+			})
+		})
+
+		context("when modules.toml is malformed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "modules-src", "modules.toml"), []byte("%%%"), 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := httpd.FindModuleSources(workingDir)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse modules-src/modules.toml")))
+			})
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// parseModuleNames splits a comma separated list of module names. Each name
+// can be given as it appears in a LoadModule directive or in the file name of
+// the module, so "headers", "headers_module" and "mod_headers.so" all refer to
+// mod_headers. The modules of httpd are named in lower case, so the names are
+// matched without regard to case.
+func parseModuleNames(value string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.TrimSuffix(name, ".so")
+		name = strings.TrimPrefix(name, "mod_")
+		name = strings.TrimSuffix(name, "_module")
+
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		names = append(names, name)
+	}
+	return names
+}
+
+// availableModules returns the names of the modules in the modules directory
+// of the server installed at serverRoot.
+func availableModules(serverRoot string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(serverRoot, "modules", "mod_*.so"))
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []string
+	for _, file := range files {
+		modules = append(modules, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "mod_"), ".so"))
+	}
+	sort.Strings(modules)
+
+	return modules, nil
+}
+
+// validateModules checks that the installed server provides each of the given
+// modules and suggests the closest names for the ones that it does not.
+func validateModules(serverRoot string, names []string) error {
+	modules, err := availableModules(serverRoot)
+	if err != nil {
+		return err
+	}
+
+	provided := map[string]bool{}
+	for _, module := range modules {
+		provided[module] = true
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "mpm_") {
+			return fmt.Errorf("failed: BP_HTTPD_MODULES cannot load the '%s' module, set BP_HTTPD_MPM to select the MPM", name)
+		}
+
+		if provided[name] {
+			continue
+		}
+
+		message := fmt.Sprintf("failed: BP_HTTPD_MODULES contains '%s', which is not a module of the installed Apache HTTP Server", name)
+		if suggestions := closestMatches(name, modules); len(suggestions) > 0 {
+			message = fmt.Sprintf("%s, did you mean '%s'?", message, strings.Join(suggestions, "' or '"))
+		}
+
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+// closestMatches returns the candidates with the smallest edit distance to
+// name, as long as that distance is small enough for a typo.
+func closestMatches(name string, candidates []string) []string {
+	limit := len(name) / 3
+	if limit < 1 {
+		limit = 1
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		distance := editDistance(name, candidate)
+		if distance > limit {
+			continue
+		}
+
+		if distance < limit {
+			limit = distance
+			matches = nil
+		}
+		matches = append(matches, candidate)
+	}
+	return matches
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,201 @@
+package httpd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// The keys of the build plan metadata through which buildpacks that require
+// httpd ask for features of the generated config.
+const (
+	PlanMetadataModules      = "modules"
+	PlanMetadataConfDir      = "conf-dir"
+	PlanMetadataDocumentRoot = "document-root"
+	PlanMetadataFastCGI      = "fastcgi-upstream"
+)
+
+// planRequirements are the config features that the httpd entries of the
+// build plan ask for, merged across all of them.
+type planRequirements struct {
+	Modules         []string
+	ConfDir         string
+	DocumentRoot    string
+	FastCGIUpstream string
+}
+
+func (r planRequirements) empty() bool {
+	return len(r.Modules) == 0 && r.ConfDir == "" && r.DocumentRoot == "" && r.FastCGIUpstream == ""
+}
+
+// mergePlanRequirements merges the requirements of the httpd entries of the
+// build plan. Modules add up, while the entries that set a directory or the
+// FastCGI upstream all have to agree on it, as there is no order among
+// buildpacks that would let one of them win.
+func mergePlanRequirements(entries []packit.BuildpackPlanEntry) (planRequirements, error) {
+	var requirements planRequirements
+
+	confDirs := map[string]bool{}
+	documentRoots := map[string]bool{}
+	fastCGIUpstreams := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Name != PlanDependencyHTTPD {
+			continue
+		}
+
+		modules, err := planMetadataList(entry.Metadata, PlanMetadataModules)
+		if err != nil {
+			return planRequirements{}, err
+		}
+		requirements.Modules = append(requirements.Modules, modules...)
+
+		for _, setting := range []struct {
+			key    string
+			values map[string]bool
+			clean  func(string) string
+		}{
+			{PlanMetadataConfDir, confDirs, filepath.Clean},
+			{PlanMetadataDocumentRoot, documentRoots, filepath.Clean},
+			{PlanMetadataFastCGI, fastCGIUpstreams, strings.TrimSpace},
+		} {
+			value, err := planMetadataString(entry.Metadata, setting.key)
+			if err != nil {
+				return planRequirements{}, err
+			}
+
+			if value != "" {
+				setting.values[setting.clean(value)] = true
+			}
+		}
+	}
+
+	var err error
+	requirements.ConfDir, err = singlePlanValue(PlanMetadataConfDir, confDirs)
+	if err != nil {
+		return planRequirements{}, err
+	}
+
+	requirements.DocumentRoot, err = singlePlanValue(PlanMetadataDocumentRoot, documentRoots)
+	if err != nil {
+		return planRequirements{}, err
+	}
+
+	requirements.FastCGIUpstream, err = singlePlanValue(PlanMetadataFastCGI, fastCGIUpstreams)
+	if err != nil {
+		return planRequirements{}, err
+	}
+
+	return requirements, nil
+}
+
+// apply adds the requirements to the build environment. The modules are
+// loaded in addition to the ones in BP_HTTPD_MODULES, while the directories
+// and the upstream that the user has configured take precedence over the ones
+// required by other buildpacks.
+func (r planRequirements) apply(buildEnvironment BuildEnvironment, logger scribe.Emitter) BuildEnvironment {
+	if len(r.Modules) > 0 {
+		logger.Subprocess("Requires the modules '%s'", strings.Join(r.Modules, "', '"))
+		buildEnvironment.Modules = strings.Join(append([]string{buildEnvironment.Modules}, r.Modules...), ",")
+	}
+
+	if r.ConfDir != "" {
+		if buildEnvironment.WebServerConfDir == "" {
+			logger.Subprocess("Requires the config fragments in '%s'", r.ConfDir)
+			buildEnvironment.PlanConfDir = r.ConfDir
+		} else {
+			logger.Subprocess("BP_WEB_SERVER_CONF_DIR takes precedence over the config fragments in '%s'", r.ConfDir)
+		}
+	}
+
+	if r.DocumentRoot != "" {
+		switch {
+		case buildEnvironment.WebServerLocations != "":
+			logger.Subprocess("BP_WEB_SERVER_LOCATIONS takes precedence over the document root '%s'", r.DocumentRoot)
+		case buildEnvironment.WebServerRoot != "":
+			logger.Subprocess("BP_WEB_SERVER_ROOT takes precedence over the document root '%s'", r.DocumentRoot)
+		default:
+			logger.Subprocess("Requires the document root '%s'", r.DocumentRoot)
+			buildEnvironment.WebServerRoot = r.DocumentRoot
+		}
+	}
+
+	if r.FastCGIUpstream != "" {
+		if buildEnvironment.FastCGIUpstream == "" {
+			logger.Subprocess("Requires the FastCGI upstream '%s'", r.FastCGIUpstream)
+			buildEnvironment.FastCGIUpstream = r.FastCGIUpstream
+		} else {
+			logger.Subprocess("BP_WEB_SERVER_FASTCGI_UPSTREAM takes precedence over the FastCGI upstream '%s'", r.FastCGIUpstream)
+		}
+	}
+
+	return buildEnvironment
+}
+
+// planMetadataString returns the string value of the given key, which is
+// empty when the key is not set.
+func planMetadataString(metadata map[string]interface{}, key string) (string, error) {
+	value, ok := metadata[key]
+	if !ok {
+		return "", nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("failed: the build plan metadata '%s' of httpd must be a string, got '%v'", key, value)
+	}
+
+	return strings.TrimSpace(s), nil
+}
+
+// planMetadataList returns the values of the given key, which can either be a
+// list of strings or a comma separated string.
+func planMetadataList(metadata map[string]interface{}, key string) ([]string, error) {
+	var values []string
+	switch value := metadata[key].(type) {
+	case nil:
+	case string:
+		values = strings.Split(value, ",")
+	case []string:
+		values = value
+	case []interface{}:
+		for _, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed: the build plan metadata '%s' of httpd must be a list of strings, got '%v'", key, value)
+			}
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("failed: the build plan metadata '%s' of httpd must be a list of strings, got '%v'", key, value)
+	}
+
+	var list []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+
+	return list, nil
+}
+
+func singlePlanValue(key string, values map[string]bool) (string, error) {
+	var list []string
+	for value := range values {
+		list = append(list, value)
+	}
+	sort.Strings(list)
+
+	switch len(list) {
+	case 0:
+		return "", nil
+	case 1:
+		return list[0], nil
+	default:
+		return "", fmt.Errorf("failed: the build plan entries for httpd require different values for '%s': '%s'", key, strings.Join(list, "', '"))
+	}
+}
@@ -0,0 +1,110 @@
+package httpd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UpstreamBindingType is the type of the service bindings that list the URLs
+// of the upstreams that BP_WEB_SERVER_PROXY_PATH is passed to.
+const UpstreamBindingType = "upstream"
+
+// DefaultProxyLBMethod is the method that spreads requests across the
+// upstreams when BP_WEB_SERVER_PROXY_LB_METHOD is not set.
+const DefaultProxyLBMethod = "byrequests"
+
+// DefaultProxyHealthCheckInterval is the number of seconds between the health
+// checks of an upstream when only BP_WEB_SERVER_PROXY_HEALTH_CHECK_PATH is
+// set.
+const DefaultProxyHealthCheckInterval = 30
+
+// proxyBalancer passes the requests under a URL path prefix to a group of
+// upstreams through mod_proxy_balancer.
+type proxyBalancer struct {
+	Path    string
+	Members []string
+	Method  string
+
+	// HealthCheckInterval is the number of seconds between health checks,
+	// which are disabled when it is zero. Upstreams are checked with a GET
+	// request for HealthCheckPath, or by opening a connection when it is
+	// empty.
+	HealthCheckInterval int
+	HealthCheckPath     string
+
+	// StickySession is the name of the cookie that routes the requests of a
+	// client to the same upstream.
+	StickySession string
+
+	// Retry is the number of seconds before an upstream that failed is tried
+	// again, which is left to httpd when it is empty.
+	Retry string
+}
+
+// parseProxyBalancer reads the balancer from the build environment. The
+// upstreams are the URLs of BP_WEB_SERVER_PROXY_UPSTREAMS, or the ones of an
+// upstream binding when the variable is not set.
+func parseProxyBalancer(buildEnvironment BuildEnvironment, bindingUpstreams string) (proxyBalancer, error) {
+	balancer := proxyBalancer{
+		Path:            normalizeURLPath(buildEnvironment.ProxyPath),
+		Method:          buildEnvironment.ProxyLBMethod,
+		HealthCheckPath: buildEnvironment.ProxyHealthCheckPath,
+		StickySession:   buildEnvironment.ProxyStickySession,
+	}
+
+	upstreams := buildEnvironment.ProxyUpstreams
+	if upstreams == "" {
+		upstreams = bindingUpstreams
+	}
+
+	for _, upstream := range strings.FieldsFunc(upstreams, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return proxyBalancer{}, fmt.Errorf("failed: upstream '%s' must be an http or https URL", upstream)
+		}
+		balancer.Members = append(balancer.Members, strings.TrimSuffix(upstream, "/"))
+	}
+
+	if len(balancer.Members) == 0 {
+		return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_PATH is set, but neither BP_WEB_SERVER_PROXY_UPSTREAMS nor a binding of type '%s' provide any upstreams", UpstreamBindingType)
+	}
+
+	switch balancer.Method {
+	case "":
+		balancer.Method = DefaultProxyLBMethod
+	case "byrequests", "bybusyness":
+	default:
+		return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_LB_METHOD must be one of 'byrequests' or 'bybusyness', got '%s'", balancer.Method)
+	}
+
+	if buildEnvironment.ProxyHealthCheckInterval != "" {
+		interval, err := strconv.Atoi(buildEnvironment.ProxyHealthCheckInterval)
+		if err != nil || interval <= 0 {
+			return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_HEALTH_CHECK_INTERVAL must be a positive number of seconds, got '%s'", buildEnvironment.ProxyHealthCheckInterval)
+		}
+		balancer.HealthCheckInterval = interval
+	} else if balancer.HealthCheckPath != "" {
+		balancer.HealthCheckInterval = DefaultProxyHealthCheckInterval
+	}
+
+	if balancer.HealthCheckPath != "" && !strings.HasPrefix(balancer.HealthCheckPath, "/") {
+		return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_HEALTH_CHECK_PATH must start with a slash, got '%s'", balancer.HealthCheckPath)
+	}
+
+	if strings.ContainsAny(balancer.StickySession, "=;, \t\"") {
+		return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_STICKY_SESSION must be the name of a cookie, got '%s'", balancer.StickySession)
+	}
+
+	if buildEnvironment.ProxyRetry != "" {
+		retry, err := strconv.Atoi(buildEnvironment.ProxyRetry)
+		if err != nil || retry < 0 {
+			return proxyBalancer{}, fmt.Errorf("failed: BP_WEB_SERVER_PROXY_RETRY must be a number of seconds, got '%s'", buildEnvironment.ProxyRetry)
+		}
+		balancer.Retry = strconv.Itoa(retry)
+	}
+
+	return balancer, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/paketo-buildpacks/packit/v2/cargo"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/draft"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -29,7 +30,10 @@ func main() {
 	logEmitter := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
 	versionParser := httpd.NewVersionParser()
 	entryResolver := draft.NewPlanner()
-	generateHTTPDConfig := httpd.NewGenerateHTTPDConfig(servicebindings.NewResolver(), logEmitter)
+	bindingResolver := servicebindings.NewResolver()
+	generateHTTPDConfig := httpd.NewGenerateHTTPDConfig(bindingResolver, logEmitter)
+	checkHTTPDConfig := httpd.NewCheckHTTPDConfig(pexec.NewExecutable("httpd"), bindingResolver, logEmitter)
+	buildHTTPDModule := httpd.NewBuildHTTPDModule(pexec.NewExecutable("apxs"), logEmitter)
 
 	var buildEnvironment httpd.BuildEnvironment
 	err := env.Parse(&buildEnvironment)
@@ -48,6 +52,8 @@ func main() {
 			entryResolver,
 			dependencyService,
 			generateHTTPDConfig,
+			checkHTTPDConfig,
+			buildHTTPDModule,
 			Generator{},
 			chronos.DefaultClock,
 			logEmitter,
@@ -0,0 +1,183 @@
+package httpd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+)
+
+// webServerRootCandidates are the directories, relative to the app, that are
+// searched for static files when BP_WEB_SERVER_ROOT is not set.
+var webServerRootCandidates = []string{"public", "dist", "build", "out", "_site"}
+
+// detectWebServerRoot returns the first of the webServerRootCandidates that
+// contains one of the given index files, or that exists when there are none
+// to look for.
+func detectWebServerRoot(workingDir string, indexes []string) (string, error) {
+	if len(indexes) == 0 {
+		for _, candidate := range webServerRootCandidates {
+			exists, err := fs.Exists(filepath.Join(workingDir, candidate))
+			if err != nil {
+				return "", err
+			}
+
+			if exists {
+				return candidate, nil
+			}
+		}
+
+		return "", fmt.Errorf("failed: could not find a web server root: none of %s exist, set BP_WEB_SERVER_ROOT to the directory that contains your static files", strings.Join(webServerRootCandidates, ", "))
+	}
+
+	for _, candidate := range webServerRootCandidates {
+		for _, index := range indexes {
+			exists, err := fs.Exists(filepath.Join(workingDir, candidate, index))
+			if err != nil {
+				return "", err
+			}
+
+			if exists {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("failed: could not find a web server root: none of %s contain an %s, set BP_WEB_SERVER_ROOT to the directory that contains your static files", strings.Join(webServerRootCandidates, ", "), strings.Join(indexes, " or an "))
+}
+
+// validateWebServerRoot checks that the given web server root, as written to
+// the generated config, exists and contains one of the given index files,
+// unless there are none to look for.
+func validateWebServerRoot(workingDir, root string, indexes []string) error {
+	path := resolveWebServerRoot(workingDir, root)
+
+	exists, err := fs.Exists(path)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("failed: web server root '%s' does not exist", root)
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	for _, index := range indexes {
+		exists, err = fs.Exists(filepath.Join(path, index))
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed: web server root '%s' does not contain an %s", root, strings.Join(indexes, " or an "))
+}
+
+// errorDocumentPattern matches the pages of a web server root that replace the
+// error responses of httpd, such as 404.html for the 404 responses.
+var errorDocumentPattern = regexp.MustCompile(`^([45][0-9]{2})\.html$`)
+
+// findErrorDocuments returns the status codes for which the given web server
+// root contains an error page.
+func findErrorDocuments(workingDir, root string) ([]string, error) {
+	entries, err := os.ReadDir(resolveWebServerRoot(workingDir, root))
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []string
+	for _, entry := range entries {
+		if match := errorDocumentPattern.FindStringSubmatch(entry.Name()); match != nil && !entry.IsDir() {
+			statuses = append(statuses, match[1])
+		}
+	}
+
+	return statuses, nil
+}
+
+// resolveWebServerRoot returns the build-time location of a web server root
+// that may reference the app directory through ${APP_ROOT}.
+func resolveWebServerRoot(workingDir, root string) string {
+	if strings.HasPrefix(root, "${APP_ROOT}") {
+		return filepath.Join(workingDir, strings.TrimPrefix(root, "${APP_ROOT}"))
+	}
+	return root
+}
+
+// checkWebServerRootPermissions walks the given web server root and returns a
+// description of every file that httpd cannot read and every directory that
+// it cannot traverse once it has switched to an unprivileged user, along with
+// symbolic links that point outside of the web server root. When fix is true,
+// the missing permissions are granted instead of being reported.
+func checkWebServerRootPermissions(root string, fix bool) ([]string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []string
+	err = filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				issues = append(issues, fmt.Sprintf("%s: symbolic link cannot be resolved", rel))
+				return nil
+			}
+
+			targetRel, err := filepath.Rel(root, target)
+			if err != nil {
+				return err
+			}
+
+			if targetRel == ".." || strings.HasPrefix(targetRel, "../") {
+				issues = append(issues, fmt.Sprintf("%s: symbolic link points outside of the web server root to '%s'", rel, target))
+			}
+
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		required, problem := os.FileMode(0444), "file is not readable"
+		if entry.IsDir() {
+			required, problem = os.FileMode(0555), "directory is not readable and traversable"
+		}
+
+		if info.Mode().Perm()&required&0007 == required&0007 {
+			return nil
+		}
+
+		if fix {
+			return os.Chmod(path, info.Mode().Perm()|required)
+		}
+
+		issues = append(issues, fmt.Sprintf("%s: %s", rel, problem))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}